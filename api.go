@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/nlopes/slack"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxAPIRequestSize is the limit of the API request body
+const maxAPIRequestSize = 1 << 20
+
+// HTTP server timeouts, responses of the API runs are written after the commands are finished
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+	httpWriteTimeout      = 10 * time.Minute
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// apiServer runs group commands for CI pipelines and webhooks through the same path as chat actions
+type apiServer struct {
+	bot *bot
+	run runFunc
+}
+
+// runRequest is the POST /v1/run request body
+type runRequest struct {
+	Group   string   `json:"group"`
+	Host    string   `json:"host"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+// runResponse is the POST /v1/run response body with results by host
+type runResponse struct {
+	Results []hostResult `json:"results,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// hostResult is the command execution result on the host, error is set if the command wasn't executed
+type hostResult struct {
+	Host       string `json:"host"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exitCode"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// newAPIServer returns the API server running commands over ssh
+func newAPIServer(b *bot) *apiServer {
+	return &apiServer{bot: b, run: runCommand}
+}
+
+// register adds API routes to the mux
+func (s *apiServer) register(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/run", s.handleRun)
+}
+
+// serveHTTP serves the bot HTTP endpoints, the listen address change requires restart
+func serveHTTP(listen string, handler http.Handler) {
+	logger.Info("HTTP server listening", "listen", listen)
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		WriteTimeout:      httpWriteTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		logger.Fatal("Error serving HTTP", "listen", listen, "err", err)
+	}
+}
+
+// handleRun authenticates the client by the bearer token, checks its ACL and runs the command
+func (s *apiServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, &runResponse{Error: "method not allowed"})
+		return
+	}
+	requestID := r.Header.Get("X-Request-Id")
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	w.Header().Set("X-Request-Id", requestID)
+	log := logger.With("request_id", requestID)
+	conf := s.bot.store.Load()
+	var client *config.APIClient
+	if conf.Settings.HTTP != nil {
+		client = conf.Settings.HTTP.Client(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	}
+	if client == nil {
+		log.Warn("API request with bad token", "remote", r.RemoteAddr)
+		permissionDenials.WithLabelValues("api", "token").Inc()
+		writeJSON(w, http.StatusUnauthorized, &runResponse{Error: "bad token"})
+		return
+	}
+
+	log = log.With("client", client.Id)
+	var req runRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestSize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, &runResponse{Error: fmt.Sprintf("bad request: %v", err)})
+		return
+	}
+	if req.Group == "" || req.Command == "" {
+		writeJSON(w, http.StatusBadRequest, &runResponse{Error: "group and command are required"})
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, &runResponse{Error: err.Error()})
+		return
+	}
+	allowed := func(group, command string) bool {
+		if client.Allowed(group, command) {
+			return true
+		}
+		permissionDenials.WithLabelValues("api", "acl").Inc()
+		log.Warn("API client isn't allowed to run the command", "group", group, "command", command)
+		writeJSON(w, http.StatusForbidden, &runResponse{Error: fmt.Sprintf("command %s/%s is not allowed", group, command)})
+		return false
+	}
+	if !allowed(req.ids(conf)) {
+		return
+	}
+
+	text := req.text()
+	log.Info("Action", "text", text)
+	a, err := parseAction(text, conf)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, &runResponse{Error: err.Error()})
+		return
+	}
+	// the host could be parsed as the command in single host groups and the group could be
+	// the action alias, so the parsed command is checked too
+	if !allowed(a.group.Id, a.command.Id) {
+		return
+	}
+	a.log = log
+	mirror := func(msg string, blocks ...slack.Block) {
+		if client.Channel != "" {
+			s.bot.post(client.Channel, msg, blocks...)
+		}
+	}
+	mirror(fmt.Sprintf("_API_ `%s`: `%s`", client.Id, codeEscaper.Replace(text)))
+
+	var resp runResponse
+	results := make([]execResult, 0, len(a.hosts))
+	for _, host := range a.hosts {
+		if len(a.hosts) > 1 {
+			mirror(fmt.Sprintf("*%s*", mrkdwnEscaper.Replace(host.Id)))
+		}
+		hr := hostResult{Host: host.Id}
+		r, res, err := runHost(a, host, s.run)
+		results = append(results, r)
+		if err != nil {
+			mirror(fmt.Sprintf("error execution action: %v", err))
+		}
+		if res == nil {
+			hr.Error = err.Error()
+			resp.Results = append(resp.Results, hr)
+			continue
+		}
+		hr.Stdout, _ = a.redactor.Redact(res.stdout)
+		hr.Stderr, _ = a.redactor.Redact(res.stderr)
+		hr.ExitCode = res.exitCode
+		hr.DurationMs = res.duration.Nanoseconds() / 1e6
+		resp.Results = append(resp.Results, hr)
+		replyOutput(a, res, mirror)
+	}
+	// API runs are stored in the history of the mirror channel
+	s.bot.record(&chatRequest{channel: client.Channel, client: client.Id, log: log}, a, text, results)
+	writeJSON(w, http.StatusOK, &resp)
+}
+
+// ids returns the group and command ids if the request uses their aliases, so ACLs are checked by ids
+func (r *runRequest) ids(conf *config.Config) (string, string) {
+	group, exist := conf.FindGroup(r.Group)
+	if !exist {
+		return r.Group, r.Command
+	}
+	if command, exist := group.FindCommand(r.Command); exist {
+		return group.Id, command.Id
+	}
+	return group.Id, r.Command
+}
+
+// validate checks that the request fields are kept as they are by the chat action text,
+// so arguments aren't split by whitespaces or read as filters
+func (r *runRequest) validate() error {
+	values := []string{r.Group, r.Command}
+	if r.Host != "" {
+		values = append(values, r.Host)
+	}
+	for _, v := range append(values, r.Args...) {
+		if v == "" || strings.IndexFunc(v, unicode.IsSpace) >= 0 || strings.Contains(v, "|") {
+			return errors.New(fmt.Sprintf("bad value %q: values can't be empty or contain whitespaces and |", v))
+		}
+	}
+	return nil
+}
+
+// text returns the chat action text for the request
+func (r *runRequest) text() string {
+	parts := []string{r.Group}
+	if r.Host != "" {
+		parts = append(parts, r.Host)
+	}
+	parts = append(parts, r.Command)
+	parts = append(parts, r.Args...)
+	return strings.Join(parts, " ")
+}
+
+// writeJSON writes the response body as JSON with the status code
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Warn("Error writing response", "err", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/nlopes/slack"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIRun(t *testing.T) {
+	conf := makeTestConfig()
+	conf.Settings.HTTP = &config.HTTP{
+		Listen: ":8080",
+		Clients: []*config.APIClient{
+			{Id: "ci", Token: "secret", Allow: []string{"group1/command1"}, Channel: "C1"},
+			{Id: "hook", Token: "other", Allow: []string{"group1/*"}},
+			{Id: "glob", Token: "glob", Allow: []string{"c*/*"}},
+			{Id: "two", Token: "two", Allow: []string{"group1/command2"}},
+		},
+	}
+	conf.Groups["group1"].Aliases = []string{"g1"}
+	conf.Groups["group1"].Commands["command1"].Aliases = []string{"c1"}
+	conf.Aliases = map[string]string{"c2": "group1 command2 arg-name"}
+	store := &configStore{}
+	store.current.Store(conf)
+
+	h, closeHistory := openTestHistory(t, 10)
+	defer closeHistory()
+	var posted []string
+	b := &bot{
+		store:   store,
+		history: h,
+		post: func(channel, text string, blocks ...slack.Block) {
+			posted = append(posted, channel+": "+text)
+		},
+	}
+	s := newAPIServer(b)
+	s.run = func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+		if rawCmd == "raw command2 arg-value" {
+			return nil, errors.New("error opening ssh connection: refused")
+		}
+		return &result{stdout: "out\n", stderr: "warn\n", output: "out\nwarn\n", duration: 1500 * time.Millisecond}, nil
+	}
+	mux := http.NewServeMux()
+	s.register(mux)
+
+	tests := []struct {
+		method string
+		token  string
+		body   string
+		status int
+		resp   string
+		posted []string
+	}{
+		{"GET", "secret", "", 405, `{"error":"method not allowed"}`, nil},
+		{"POST", "bad", `{}`, 401, `{"error":"bad token"}`, nil},
+		{"POST", "secret", `{`, 400, `{"error":"bad request: unexpected EOF"}`, nil},
+		{"POST", "secret", `{"group":"group1"}`, 400, `{"error":"group and command are required"}`, nil},
+		{"POST", "secret", `{"group":"group1","command":"command2","args":["arg-name"]}`, 403, `{"error":"command group1/command2 is not allowed"}`, nil},
+		{"POST", "secret", `{"group":"group1","command":"command1"}`, 200,
+			`{"results":[{"host":"onehost","stdout":"out\n","stderr":"warn\n","exitCode":0,"durationMs":1500}]}`,
+			[]string{"C1: _API_ `ci`: `group1 command1`", "C1: out\nwarn"}},
+		{"POST", "secret", `{"group":"g1","command":"c1"}`, 200,
+			`{"results":[{"host":"onehost","stdout":"out\n","stderr":"warn\n","exitCode":0,"durationMs":1500}]}`,
+			[]string{"C1: _API_ `ci`: `g1 c1`", "C1: out\nwarn"}},
+		{"POST", "glob", `{"group":"c2","command":"x"}`, 403, `{"error":"command group1/command2 is not allowed"}`, nil},
+		{"POST", "two", `{"group":"group1","host":"command1","command":"command2"}`, 403, `{"error":"command group1/command1 is not allowed"}`, nil},
+		{"POST", "other", `{"group":"group1","command":"command2","args":["none"]}`, 400,
+			`{"error":"argument value *none* not found\ncommand2 help"}`, nil},
+		{"POST", "other", `{"group":"group1","command":"command2","args":["arg-name"]}`, 200,
+			`{"results":[{"host":"onehost","stdout":"","stderr":"","exitCode":0,"durationMs":0,"error":"error opening ssh connection: refused"}]}`, nil},
+		{"POST", "other", `{"group":"group1","command":"command2","args":["arg-name | grep x"]}`, 400,
+			`{"error":"bad value \"arg-name | grep x\": values can't be empty or contain whitespaces and |"}`, nil},
+		{"POST", "other", `{"group":"group1","command":"command2","args":["arg-name\tx"]}`, 400,
+			`{"error":"bad value \"arg-name\\tx\": values can't be empty or contain whitespaces and |"}`, nil},
+		{"POST", "other", `{"group":"group1","command":"command2","args":[""]}`, 400,
+			`{"error":"bad value \"\": values can't be empty or contain whitespaces and |"}`, nil},
+	}
+	for i, test := range tests {
+		posted = nil
+		r := httptest.NewRequest(test.method, "/v1/run", strings.NewReader(test.body))
+		r.Header.Set("Authorization", "Bearer "+test.token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%d: Got status: %d, want: %d", i, w.Code, test.status)
+		}
+		if resp := strings.TrimSpace(w.Body.String()); resp != test.resp {
+			t.Errorf("%d: Got response: %s, want: %s", i, resp, test.resp)
+		}
+		if strings.Join(posted, "|") != strings.Join(test.posted, "|") {
+			t.Errorf("%d: Got posted: %q, want: %q", i, posted, test.posted)
+		}
+	}
+
+	executions, err := h.last(10, func(e *execution) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executions) != 3 {
+		t.Fatalf("Got %d executions, want: 3", len(executions))
+	}
+	if e := executions[0]; e.Client != "hook" || e.Channel != "" || e.Results[0].Error != "error opening ssh connection: refused" {
+		t.Errorf("Got execution: %+v", e)
+	}
+	if e := executions[2]; e.Client != "ci" || e.Channel != "C1" || e.Text != "group1 command1" || e.author() != "_API_ `ci`" {
+		t.Errorf("Got execution: %+v", e)
+	}
+}
+
+func TestAPIRunRedaction(t *testing.T) {
+	conf := makeTestConfig()
+	conf.Settings.Redactions = []*regexp.Regexp{regexp.MustCompile(`sk_live_\w+`)}
+	conf.Settings.HTTP = &config.HTTP{
+		Listen:  ":8080",
+		Clients: []*config.APIClient{{Id: "ci", Token: "secret", Allow: []string{"group1/*"}}},
+	}
+	store := &configStore{}
+	store.current.Store(conf)
+
+	h, closeHistory := openTestHistory(t, 10)
+	defer closeHistory()
+	s := newAPIServer(&bot{store: store, history: h})
+	s.run = func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+		return &result{stdout: "STRIPE=sk_live_abc\n", stderr: "login gayjke\n", output: "STRIPE=sk_live_abc\nlogin gayjke\n"}, nil
+	}
+	mux := http.NewServeMux()
+	s.register(mux)
+
+	r := httptest.NewRequest("POST", "/v1/run", strings.NewReader(`{"group":"group1","command":"command1"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	want := `{"results":[{"host":"onehost","stdout":"STRIPE=[REDACTED]\n","stderr":"login [REDACTED]\n","exitCode":0,"durationMs":0}]}`
+	if resp := strings.TrimSpace(w.Body.String()); resp != want {
+		t.Errorf("Got response: %s, want: %s", resp, want)
+	}
+
+	executions, err := h.last(1, func(e *execution) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executions) != 1 || executions[0].Results[0].Output != "STRIPE=[REDACTED]\nlogin [REDACTED]\n" {
+		t.Errorf("Got executions: %+v", executions)
+	}
+}
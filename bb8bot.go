@@ -1,53 +1,167 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/karlovskiy/bb8bot/config"
+	"github.com/karlovskiy/bb8bot/logging"
+	"github.com/karlovskiy/bb8bot/pipeline"
+	"github.com/karlovskiy/bb8bot/redact"
 	"github.com/nlopes/slack"
 	"golang.org/x/crypto/ssh"
+	"io"
 	"io/ioutil"
-	"log"
+	"net/http"
 	"os"
 	"strings"
-	"unicode/utf8"
+	"sync"
+	"time"
 )
 
 var (
 	configPath = flag.String("c", "", "config path")
+	logLevel   = flag.String("log-level", "info", "log level: debug, info, warn or error")
+	logFormat  = flag.String("log-format", "text", "log format: text or json")
 )
 
+// logger is the bot logger, per request loggers are created from it with correlation ids
+var logger = logging.New(os.Stderr, logging.Info, logging.Text)
+
 func main() {
 
 	flag.Parse()
-	log.SetFlags(log.Lshortfile | log.LstdFlags)
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		logger.Fatal("Bad flag", "err", err)
+	}
+	format, err := logging.ParseFormat(*logFormat)
+	if err != nil {
+		logger.Fatal("Bad flag", "err", err)
+	}
+	logger = logging.New(os.Stderr, level, format)
+
+	if flag.Arg(0) == "healthcheck" {
+		conf, err := config.ParseFile(*configPath)
+		if err != nil {
+			logger.Fatal("Error parsing config", "path", *configPath, "err", err)
+		}
+		if err := healthcheck(conf); err != nil {
+			logger.Fatal("Healthcheck failed", "err", err)
+		}
+		return
+	}
 
-	conf, err := config.ParseFile(*configPath)
+	store, err := newConfigStore(*configPath)
 	if err != nil {
-		log.Fatalf("Error parsing '%s': %v", *configPath, err)
+		logger.Fatal("Error parsing config", "path", *configPath, "err", err)
 	}
+	conf := store.Load()
+	redactLogs(conf)
+	store.onReload(redactLogs)
+	go store.watch()
+	go store.discover()
 
 	api := slack.New(
 		conf.Settings.Token,
-		slack.OptionDebug(true),
-		slack.OptionLog(log.New(os.Stdout, "", log.Lshortfile|log.LstdFlags)),
+		slack.OptionDebug(logger.Enabled(logging.Debug)),
+		slack.OptionLog(logger.With("component", "slack")),
 	)
 
 	rtm := api.NewRTM()
+	b := &bot{
+		store: store,
+		run:   runCommand,
+		post: func(channel, text string, blocks ...slack.Block) {
+			if len(blocks) == 0 {
+				rtm.SendMessage(rtm.NewOutgoingMessage(text, channel))
+				return
+			}
+			// RTM doesn't support blocks, so they are posted by the web API
+			_, _, err := api.PostMessage(channel, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...), slack.MsgOptionAsUser(true))
+			if err != nil {
+				logger.Error("Error posting message", "channel", channel, "err", err)
+			}
+		},
+		update: func(channel, ts, text string, blocks ...slack.Block) {
+			_, _, _, err := api.UpdateMessage(channel, ts, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...))
+			if err != nil {
+				logger.Error("Error updating message", "channel", channel, "ts", ts, "err", err)
+			}
+		},
+	}
+	if h := conf.Settings.History; h != nil {
+		b.history, err = openHistory(h)
+		if err != nil {
+			logger.Fatal("Error opening history", "err", err)
+		}
+		defer b.history.close()
+	}
+	b.scheduler = newScheduler(b)
+	store.onReload(b.scheduler.sync)
+	b.scheduler.sync(conf)
+	b.scheduler.start()
+	b.checker = newChecker(b)
+	go b.checker.loop()
+
+	registerQueueDepth(func() int {
+		return len(rtm.IncomingEvents)
+	})
+	if h := conf.Settings.HTTP; h != nil {
+		mux := http.NewServeMux()
+		newAPIServer(b).register(mux)
+		newBuilder(b).register(mux)
+		registerMetrics(mux)
+		newHealth(b).register(mux)
+		go serveHTTP(h.Listen, mux)
+	}
+
 	go rtm.ManageConnection()
-	handleIncomingEvents(rtm, conf)
+	handleIncomingEvents(rtm, b)
+
+}
 
+// bot is the state shared by chat events handling, schedules and etc.
+type bot struct {
+	store     *configStore
+	scheduler *scheduler
+	checker   *checker
+	history   *history
+	run       runFunc
+	post      func(channel, text string, blocks ...slack.Block)
+	update    func(channel, ts, text string, blocks ...slack.Block)
+	connected int32
+}
+
+// chatRequest is the chat message author and channel with the request logger
+type chatRequest struct {
+	user    string
+	channel string
+	// client is the API client id for actions run by the HTTP API
+	client  string
+	isAdmin bool
+	log     *logging.Logger
+}
+
+// redactLogs makes the logger redact the config secrets, including the ones resolved later by references
+func redactLogs(conf *config.Config) {
+	logger.SetSecrets(conf.Secrets())
+	conf.OnSecretResolved(func(secret string) {
+		logger.AddSecrets(secret)
+	})
 }
 
 // handleIncomingEvents handles all incoming RTM events
-func handleIncomingEvents(rtm *slack.RTM, conf *config.Config) {
+func handleIncomingEvents(rtm *slack.RTM, b *bot) {
 	for msg := range rtm.IncomingEvents {
 
 		switch ev := msg.Data.(type) {
 
 		case *slack.MessageEvent:
-			log.Printf("Message: %+v", ev)
+			logger.Debug("Message", "user", ev.User, "channel", ev.Channel, "ts", ev.Timestamp)
 
 			info := rtm.GetInfo()
 			prefix := "<@" + info.User.ID + ">"
@@ -55,158 +169,528 @@ func handleIncomingEvents(rtm *slack.RTM, conf *config.Config) {
 			action := strings.TrimPrefix(text, prefix)
 			if action != text {
 
+				conf := b.store.Load()
 				user := ev.User
 				channel := ev.Channel
-				log.Printf("User : %q Channel: %q", user, channel)
-
-				users := conf.Settings.Users
-				channels := conf.Settings.Channels
+				req := &chatRequest{
+					user:    user,
+					channel: channel,
+					log:     logger.With("request_id", newRequestID(), "user", user, "channel", channel),
+				}
 
-				_, isAdmin := conf.Settings.Admins[user]
-				if _, isUserPermitted := users[user]; len(users) > 0 && !isUserPermitted && !isAdmin {
-					log.Printf("User %q doesn't have enough permissions", user)
-					rtm.SendMessage(rtm.NewOutgoingMessage("You don't have enough permissions", channel))
+				if denied := checkPermissions(req, conf, "chat"); denied != "" {
+					rtm.SendMessage(rtm.NewOutgoingMessage(denied, channel))
 				} else {
-					if _, isChannelPermitted := channels[channel]; len(channels) > 0 && !isChannelPermitted && !isAdmin {
-						log.Printf("Channel %q doesn't have enough permissions", channel)
-						rtm.SendMessage(rtm.NewOutgoingMessage("This channel doesn't have enough permissions", channel))
-					} else {
-
-						action = strings.TrimSpace(action)
-						rawCmd, command, host, err := parseAction(action, conf)
-						if err != nil {
-							rtm.SendMessage(rtm.NewOutgoingMessage(fmt.Sprintf("%v", err), channel))
-						} else {
-							msgs, err := execute(rawCmd, command, host)
-							if err != nil {
-								rtm.SendMessage(rtm.NewOutgoingMessage(fmt.Sprintf("error execution action: %v", err), channel))
-							}
-							for _, msg := range msgs {
-								rtm.SendMessage(rtm.NewOutgoingMessage(msg, channel))
-							}
-						}
-					}
+
+					action = strings.TrimSpace(action)
+					b.handleAction(req, action, conf, func(msg string, blocks ...slack.Block) {
+						b.post(channel, msg, blocks...)
+					})
 				}
 			}
+		case *slack.ConnectedEvent:
+			logger.Info("Connected to Slack", "connection_count", ev.ConnectionCount)
+			slackConnected.Set(1)
+			b.setConnected(true)
+			if ev.ConnectionCount > 0 {
+				slackReconnects.Inc()
+			}
+		case *slack.DisconnectedEvent:
+			logger.Warn("Disconnected from Slack", "intentional", ev.Intentional)
+			slackConnected.Set(0)
+			b.setConnected(false)
 		default:
 			// Ignore other events..
 		}
 	}
 }
 
-// parseAction parses action from chat message and convert it to ssh command for execution
-func parseAction(action string, conf *config.Config) (rawCmd *string, command *config.Command, host *config.Host, err error) {
-	log.Printf("Parse action: %q", action)
+// checkPermissions sets whether the request user is admin and returns the denial message
+// if the user or the channel isn't permitted, source is the denials metric label
+func checkPermissions(req *chatRequest, conf *config.Config, source string) string {
+	users := conf.Settings.Users
+	channels := conf.Settings.Channels
+
+	_, isAdmin := conf.Settings.Admins[req.user]
+	req.isAdmin = isAdmin
+	if _, isUserPermitted := users[req.user]; len(users) > 0 && !isUserPermitted && !isAdmin {
+		req.log.Warn("User doesn't have enough permissions")
+		permissionDenials.WithLabelValues(source, "user").Inc()
+		return "You don't have enough permissions"
+	}
+	if _, isChannelPermitted := channels[req.channel]; len(channels) > 0 && !isChannelPermitted && !isAdmin {
+		req.log.Warn("Channel doesn't have enough permissions")
+		permissionDenials.WithLabelValues(source, "channel").Inc()
+		return "This channel doesn't have enough permissions"
+	}
+	return ""
+}
+
+// handleAction handles bot commands and group actions from chat and sends replies
+func (b *bot) handleAction(req *chatRequest, text string, conf *config.Config, reply replyFunc) {
+	req.log.Info("Action", "text", text)
+	fields := strings.Fields(text)
+	if len(fields) > 0 {
+		switch fields[0] {
+		case "reload":
+			reply(reloadConfig(b.store, req.isAdmin))
+			return
+		case "schedules", "schedule":
+			reply(b.scheduler.command(fields[1:], req.isAdmin))
+			return
+		case "history", "show", "rerun", "diff", "!!":
+			b.historyCommand(req, fields, conf, reply)
+			return
+		case "checks":
+			reply(b.checker.list())
+			return
+		}
+	}
+	if fields, diffMode := diffFlag(fields); diffMode {
+		b.runDiff(req, strings.Join(fields, " "), nil, conf, reply)
+		return
+	}
+	// the group without a command gets the interactive builder instead of the group help
+	if len(fields) == 1 && builderEnabled(conf) && conf.ExpandAlias(text) == text {
+		if groupId, err := findName("group", fields[0], groupNames(conf), conf.Help); err == nil {
+			group := conf.Groups[groupId]
+			reply(group.Help, builderBlocks(group, &builderState{Group: group.Id}, "")...)
+			return
+		}
+	}
+	a, err := parseAction(text, conf)
+	if err != nil {
+		reply(fmt.Sprintf("%v", err))
+		return
+	}
+	a.log = req.log
+	b.record(req, a, strings.Join(fields, " "), runAction(a, b.run, reply))
+}
+
+// runAction executes the action on all its hosts with run, sends the output and returns results by host
+func runAction(a *action, run runFunc, reply replyFunc) []execResult {
+	results := make([]execResult, 0, len(a.hosts))
+	for _, host := range a.hosts {
+		if len(a.hosts) > 1 {
+			reply(fmt.Sprintf("*%s*", mrkdwnEscaper.Replace(host.Id)))
+		}
+		r, res, err := runHost(a, host, run)
+		results = append(results, r)
+		if err != nil {
+			reply(fmt.Sprintf("error execution action: %v", err))
+		}
+		if res != nil {
+			replyOutput(a, res, reply)
+		}
+	}
+	return results
+}
+
+// replyOutput sends the sanitized host output with secrets redacted and notes the number of redacted secrets.
+// Structured outputs are rendered from stdout, so warnings can't break them, and stderr is sent after them.
+func replyOutput(a *action, res *result, reply replyFunc) {
+	output, stderr := res.output, ""
+	if a.command.Output != nil {
+		output, stderr = res.stdout, res.stderr
+	}
+	output, redacted := a.redactor.Redact(sanitizeOutput(output))
+	sendOutput(a, output, reply)
+	if stderr, n := a.redactor.Redact(sanitizeOutput(stderr)); strings.TrimSpace(stderr) != "" {
+		redacted += n
+		reply("_stderr:_")
+		for _, msg := range outputMessages(stderr, true, a.command.MaxSymbolsPerMessage, a.command.MaxMessages) {
+			reply(msg)
+		}
+	}
+	if redacted > 0 {
+		reply(redactedNote(redacted))
+	}
+}
+
+// sendOutput sends the output rendered by the command output format and narrowed by the action filters,
+// filters are applied to the rendered text, so json objects are sent as Block Kit fields only without filters
+func sendOutput(a *action, output string, reply replyFunc) {
+	code := a.command.CodeBlock
+	if out := a.command.Output; out != nil {
+		r, err := renderOutput(out, output, a.filter == nil)
+		switch {
+		case err != nil:
+			reply(fmt.Sprintf("error rendering %s output: %v", out.Format, err))
+		case r.blocks != nil:
+			reply(mrkdwnEscaper.Replace(r.text), r.blocks...)
+			return
+		default:
+			output, code = r.text, code || r.code
+		}
+	}
+	filtered := a.filter.Apply(output)
+	if filtered == "" && a.filter != nil && output != "" {
+		reply(fmt.Sprintf("_Nothing left after_ `%s`", codeEscaper.Replace(a.filter.Text)))
+		return
+	}
+	for _, msg := range outputMessages(filtered, code, a.command.MaxSymbolsPerMessage, a.command.MaxMessages) {
+		reply(msg)
+	}
+}
+
+// runHost executes the action on the host and returns the stored and the full results
+// with the error if the command couldn't be executed or exited with non-zero status,
+// the full result is nil only if the command couldn't be executed.
+// The stored output is sanitized and redacted, so secrets don't get into the history.
+func runHost(a *action, host *config.Host, run runFunc) (execResult, *result, error) {
+	r := execResult{Host: host.Id, Cmd: a.rawCmds[host.Id]}
+	res, err := a.execute(host, run)
+	if err != nil {
+		r.Error = err.Error()
+		return r, nil, err
+	}
+	r.Output, _ = a.redactor.Redact(sanitizeOutput(res.output))
+	r.ExitCode = res.exitCode
+	r.DurationMs = res.duration.Nanoseconds() / 1e6
+	return r, res, res.exitError()
+}
 
-	if action == "" || action == "help" {
-		return nil, nil, nil, errors.New(conf.Help)
+// reloadConfig reloads config by admin request and returns the reply message
+func reloadConfig(store *configStore, isAdmin bool) string {
+	if !isAdmin {
+		permissionDenials.WithLabelValues("chat", "admin").Inc()
+		return "Only admins can reload config"
+	}
+	if _, err := store.Reload(); err != nil {
+		return fmt.Sprintf("error reloading config, the current one is kept: %v", err)
+	}
+	return "Config reloaded"
+}
+
+// action is the parsed chat action: the command and hosts to execute it on with rendered commands by host id.
+// The action is logged with the request logger.
+type action struct {
+	group    *config.Group
+	command  *config.Command
+	hosts    []*config.Host
+	rawCmds  map[string]string
+	filter   *pipeline.Pipeline
+	redactor *redact.Redactor
+	log      *logging.Logger
+}
+
+// parseAction parses action from chat message and convert it to ssh command for execution
+func parseAction(text string, conf *config.Config) (*action, error) {
+	text = conf.ExpandAlias(text)
+	var filter *pipeline.Pipeline
+	if i := pipeline.Index(text); i >= 0 {
+		var err error
+		filter, err = pipeline.Parse(text[i+1:])
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("bad filter: %v", err))
+		}
+		text = strings.TrimSpace(text[:i])
+	}
+	if text == "" || text == "help" {
+		return nil, errors.New(conf.Help)
 	}
 
-	actionParts := strings.Fields(action)
+	actionParts := strings.Fields(text)
 	searchGroup := actionParts[0]
-	group, exist := conf.Groups[searchGroup]
-	if !exist {
-		return nil, nil, nil, errors.New(fmt.Sprintf("group *%s* not found\n%s", searchGroup, conf.Help))
+	groupId, err := findName("group", searchGroup, groupNames(conf), conf.Help)
+	if err != nil {
+		return nil, err
 	}
+	group := conf.Groups[groupId]
 	if len(actionParts) < 2 {
-		return nil, nil, nil, errors.New(group.Help)
+		return nil, errors.New(group.Help)
 	}
 
 	searchHostOrCommand := actionParts[1]
-	if len(actionParts) == 3 && actionParts[2] == "help" {
-		helpCommand, exist := group.Commands[searchHostOrCommand]
-		if exist {
-			return nil, nil, nil, errors.New(helpCommand.Help)
+	if _, isHost := group.Hosts[searchHostOrCommand]; len(actionParts) == 3 && actionParts[2] == "help" && !isHost {
+		if commandId, exist := commandNames(group)[searchHostOrCommand]; exist {
+			return nil, errors.New(group.Commands[commandId].Help)
 		}
 	}
 
-	if len(group.Hosts) == 0 {
-		return nil, nil, nil, errors.New(fmt.Sprintf("hosts for group *%s* not found\n%s", group.Id, group.Help))
+	var hosts []*config.Host
+	cmdIndex := 1
+	if strings.HasPrefix(searchHostOrCommand, "@") {
+		selector, err := hostsSelector(searchHostOrCommand[1:])
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%v\n%s", err, group.Help))
+		}
+		hosts = selector.Select(group.Hosts)
+		if len(hosts) == 0 {
+			return nil, errors.New(fmt.Sprintf("hosts with tags *%s* not found\n%s", mrkdwnEscaper.Replace(searchHostOrCommand[1:]), group.Help))
+		}
+		cmdIndex = 2
+	} else if len(group.Hosts) == 0 {
+		return nil, errors.New(fmt.Sprintf("hosts for group *%s* not found\n%s", group.Id, group.Help))
 	} else if len(group.Hosts) == 1 {
 		for _, h := range group.Hosts {
-			host = h
+			hosts = append(hosts, h)
+		}
+		if hosts[0].Id == searchHostOrCommand {
+			cmdIndex = 2
 		}
 	} else {
-		host, exist = conf.Hosts[searchHostOrCommand]
+		host, exist := conf.Hosts[searchHostOrCommand]
 		if !exist {
-			return nil, nil, nil, errors.New(fmt.Sprintf("host *%s* not found,\n%s", searchHostOrCommand, group.Help))
+			hostId, err := findName("host", searchHostOrCommand, hostNames(group), group.Help)
+			if err != nil {
+				return nil, err
+			}
+			host = group.Hosts[hostId]
 		}
+		hosts = append(hosts, host)
+		cmdIndex = 2
 	}
-	if host == nil {
-		return nil, nil, nil, errors.New(fmt.Sprintf("host or command *%s* not found\n%s", searchHostOrCommand, conf.Help))
+	if len(actionParts) <= cmdIndex {
+		return nil, errors.New(fmt.Sprintf("command *%s* not found\n%s", mrkdwnEscaper.Replace(searchHostOrCommand), group.Help))
 	}
-	searchCommand := searchHostOrCommand
-	cmdIndex := 1
-	if host.Id == searchHostOrCommand {
-		if len(actionParts) < 3 {
-			return nil, nil, nil, errors.New(fmt.Sprintf("command *%s* not found\n%s", searchHostOrCommand, group.Help))
-		}
-		searchCommand = actionParts[2]
-		cmdIndex = 2
+	searchCommand := actionParts[cmdIndex]
+
+	// commands and argument values are matched by prefixes only if it is enabled, so a prefix doesn't run them by mistake
+	find := findExactName
+	if conf.Settings.CommandPrefixes {
+		find = findName
 	}
-	var rawCommand string
-	command, exist = group.Commands[searchCommand]
-	if exist {
-		helpIndex := cmdIndex + 1
-		if len(actionParts) > helpIndex && actionParts[helpIndex] == "help" {
-			return nil, nil, nil, errors.New(command.Help)
-		}
-		if len(command.Arguments) == 0 {
-			rawCommand = command.Format
-		} else {
-			args := make([]interface{}, len(command.Arguments))
-			for i, arg := range command.Arguments {
-				argIndex := i + cmdIndex + 1
-				if len(actionParts) <= argIndex {
-					return nil, nil, nil, errors.New(
-						fmt.Sprintf("*%d* argument not found\n%s", i+1, command.Help))
-				}
-				argValue := strings.Trim(actionParts[argIndex], conf.Settings.ArgumentsTrimCutSet)
-				found := false
-				for _, item := range arg.Items {
-					if argValue == item.Name {
-						args[i] = item.Value
-						found = true
-						break
-					}
-				}
-				if !found {
-					return nil, nil, nil, errors.New(
-						fmt.Sprintf("argument value *%s* not found\n%s", argValue, command.Help))
-				}
+	commandId, err := find("command", searchCommand, commandNames(group), group.Help)
+	if err != nil {
+		return nil, err
+	}
+	command := group.Commands[commandId]
+	helpIndex := cmdIndex + 1
+	if len(actionParts) > helpIndex && actionParts[helpIndex] == "help" {
+		return nil, errors.New(command.Help)
+	}
+	args := make([]interface{}, len(command.Arguments))
+	for i, arg := range command.Arguments {
+		argIndex := i + cmdIndex + 1
+		if len(actionParts) <= argIndex {
+			return nil, errors.New(
+				fmt.Sprintf("*%d* argument not found\n%s", i+1, command.Help))
+		}
+		argValue := strings.Trim(actionParts[argIndex], conf.Settings.ArgumentsTrimCutSet)
+		name, err := find("argument value", argValue, itemNames(arg), command.Help)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range arg.Items {
+			if item.Name == name {
+				args[i] = item.Value
+				break
 			}
-			rawCommand = fmt.Sprintf(command.Format, args...)
 		}
 	}
-	if rawCommand == "" {
-		return nil, nil, nil, errors.New(fmt.Sprintf("command *%s* not found\n%s", searchCommand, group.Help))
+
+	var allowed []*config.Host
+	for _, h := range hosts {
+		if command.Allowed(h) {
+			allowed = append(allowed, h)
+		}
+	}
+	if len(allowed) == 0 {
+		target := hosts[0].Id
+		if cmdIndex == 2 {
+			target = searchHostOrCommand
+		}
+		return nil, errors.New(fmt.Sprintf("command *%s* is not allowed on *%s*\n%s", command.Id, target, command.Help))
+	}
+
+	rawCmds := make(map[string]string, len(allowed))
+	for _, h := range allowed {
+		rawCmd, err := command.Render(group.HostVars(h), args)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("error rendering command *%s* for host *%s*: %v", command.Id, h.Id, err))
+		}
+		rawCmds[h.Id] = rawCmd
+	}
+
+	return &action{
+		group:    group,
+		command:  command,
+		hosts:    allowed,
+		filter:   filter,
+		redactor: redact.New(conf.Settings.Redactions, command.Redactions).WithSecrets(conf.Secrets),
+		rawCmds:  rawCmds,
+		log:      logger,
+	}, nil
+}
+
+// hostsSelector returns the selector for the chat tags list like "web,eu" that matches hosts with all tags
+func hostsSelector(tags string) (*config.Selector, error) {
+	var exprs []string
+	for _, t := range strings.Split(tags, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			exprs = append(exprs, t)
+		}
+	}
+	if len(exprs) == 0 {
+		return nil, errors.New("hosts tags are not set")
 	}
+	return config.ParseSelector(strings.Join(exprs, " && "))
+}
+
+// replyFunc sends the reply message, the message text is the fallback of the blocks if they are set
+type replyFunc func(msg string, blocks ...slack.Block)
+
+// runFunc executes the rendered command on the host
+type runFunc func(rawCmd string, command *config.Command, host *config.Host) (*result, error)
+
+// execute executes the action command on the host with run and records metrics
+func (a *action) execute(host *config.Host, run runFunc) (*result, error) {
+	log := a.log.With("group", a.group.Id, "command", a.command.Id, "host", host.Id)
+	log.Info("Execute command", "address", fmt.Sprintf("%s:%d", host.Address, host.Port), "cmd", a.rawCmds[host.Id])
+	activeJobs.Inc()
+	defer activeJobs.Dec()
+	res, err := run(a.rawCmds[host.Id], a.command, host)
+	observeCommand(a, host.Id, res, err)
+	if err != nil {
+		log.Error("Command failed", "err", err)
+	} else {
+		log.Info("Command finished", "exit_code", res.exitCode, "duration", res.duration)
+	}
+	return res, err
+}
+
+// result is the ssh command execution result with separate and combined outputs
+type result struct {
+	stdout   string
+	stderr   string
+	output   string
+	exitCode int
+	duration time.Duration
+	exitErr  *ssh.ExitError
+}
 
-	return &rawCommand, command, host, nil
+// exitError returns the error if the command exited with non-zero status,
+// the output isn't included, so it is sent sanitized and redacted separately
+func (r *result) exitError() error {
+	if r.exitErr == nil {
+		return nil
+	}
+	return errors.New(fmt.Sprintf("error calling ssh command: %v", r.exitErr))
 }
 
-// execute executes ssh command on specified host
-func execute(rawCmd *string, command *config.Command, host *config.Host) ([]string, error) {
+// runCommand executes ssh command on specified host.
+// Non-zero exit status is returned in the result, errors are returned for connection failures.
+func runCommand(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+	start := time.Now()
+	client, err := dial(host, command.Timeout)
+	if err != nil && isAuthError(err) && host.Auth.RefreshSecrets() {
+		// secrets could be rotated, so read them again and retry
+		client, err = dial(host, command.Timeout)
+	}
+	sshDialDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		sshDialFailures.WithLabelValues(host.Id).Inc()
+		return nil, err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error creating ssh session: %v", err))
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	combined := &syncBuffer{}
+	session.Stdout = io.MultiWriter(&stdout, combined)
+	session.Stderr = io.MultiWriter(&stderr, combined)
+	err = session.Run(rawCmd)
+	res := &result{
+		stdout:   stdout.String(),
+		stderr:   stderr.String(),
+		output:   combined.String(),
+		duration: time.Since(start),
+	}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		res.exitCode = exitErr.ExitStatus()
+		res.exitErr = exitErr
+	} else if err != nil {
+		return nil, errors.New(fmt.Sprintf("error calling ssh command: %v", err))
+	}
+	return res, nil
+}
+
+// syncBuffer is the buffer for stdout and stderr written concurrently by the ssh session
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// dial opens ssh connection to the host, through its jump host if it is set
+func dial(host *config.Host, timeout time.Duration) (*ssh.Client, error) {
 	addr := fmt.Sprintf("%s:%d", host.Address, host.Port)
-	log.Printf("Execute cmd: %q on host: %q", *rawCmd, addr)
+	sshConf, err := clientConfig(addr, host.Auth, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if host.Jump == nil {
+		client, err := ssh.Dial("tcp", addr, sshConf)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("error opening ssh connection: %v", err))
+		}
+		return client, nil
+	}
 
-	auth := host.Auth
+	jumpClient, err := dial(host.Jump, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := jumpClient.Dial("tcp", addr)
+	if err != nil {
+		jumpClient.Close()
+		return nil, errors.New(fmt.Sprintf("error opening connection through jump host %q: %v", host.Jump.Id, err))
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConf)
+	if err != nil {
+		jumpClient.Close()
+		return nil, errors.New(fmt.Sprintf("error opening ssh connection: %v", err))
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	go func() {
+		client.Wait()
+		jumpClient.Close()
+	}()
+	return client, nil
+}
+
+// clientConfig creates ssh client config with the host authentication
+func clientConfig(addr string, auth *config.Auth, timeout time.Duration) (*ssh.ClientConfig, error) {
 	sshConf := &ssh.ClientConfig{
 		User:            auth.Username,
-		Timeout:         command.Timeout,
+		Timeout:         timeout,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
 
 	if auth.Type == "password" {
+		password, err := auth.ResolvePassword()
+		if err != nil {
+			return nil, err
+		}
 		sshConf.Auth = []ssh.AuthMethod{
-			ssh.Password(auth.Password),
+			ssh.Password(password),
 		}
 	} else if auth.Type == "publickey" {
 		key, err := ioutil.ReadFile(auth.PrivateKeyPath)
 		if err != nil {
 			return nil, errors.New(fmt.Sprintf("error loading private key %q: %v", auth.PrivateKeyPath, err))
 		}
-		signer, err := ssh.ParsePrivateKeyWithPassphrase(key, []byte(auth.Passphrase))
+		passphrase, err := auth.ResolvePassphrase()
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
 		if err != nil {
 			return nil, errors.New(fmt.Sprintf("error parsing private key %q: %v", auth.PrivateKeyPath, err))
 		}
@@ -216,52 +700,20 @@ func execute(rawCmd *string, command *config.Command, host *config.Host) ([]stri
 	} else {
 		return nil, errors.New(fmt.Sprintf("bad host %q auth type: %q", addr, auth.Type))
 	}
+	return sshConf, nil
+}
 
-	client, err := ssh.Dial("tcp", addr, sshConf)
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("error opening ssh connection: %v", err))
-	}
-	defer client.Close()
-	session, err := client.NewSession()
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("error creating ssh session: %v", err))
-	}
-	defer session.Close()
-
-	data, err := session.CombinedOutput(*rawCmd)
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("error calling ssh command: %v, out: %s", err, data))
-	}
-
-	return createMessages(string(data), command.MaxSymbolsPerMessage, command.MaxMessages), nil
+// isAuthError reports whether the ssh connection was rejected because of bad credentials
+func isAuthError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "unable to authenticate") || strings.Contains(msg, "decryption password incorrect")
 }
 
-// createMessages creates messages to send after execution
-func createMessages(output string, maxSymbolsPerMessage int, maxMessages int) (msgs []string) {
-	var b strings.Builder
-	size := utf8.RuneCountInString(output)
-	symbolsPerMessage := 0
-	for i, r := range []rune(output) {
-		b.WriteRune(r)
-		symbolsPerMessage++
-		if (maxSymbolsPerMessage > 0 && symbolsPerMessage == maxSymbolsPerMessage) || i == size-1 {
-			msg := b.String()
-			b.Reset()
-			lastLFIndex := strings.LastIndex(msg, "\n")
-			if lastLFIndex == -1 || lastLFIndex == len(msg) {
-				msgs = append(msgs, msg)
-			} else {
-				beforeLF := msg[:lastLFIndex]
-				if beforeLF != "" {
-					msgs = append(msgs, beforeLF)
-				}
-				b.WriteString(msg[lastLFIndex+1:])
-			}
-			symbolsPerMessage = 0
-			if maxMessages > 0 && maxMessages == len(msgs) {
-				return
-			}
-		}
+// newRequestID returns the random correlation id for logs of the request
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
 	}
-	return
+	return hex.EncodeToString(id)
 }
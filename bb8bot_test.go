@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"github.com/karlovskiy/bb8bot/config"
+	"github.com/karlovskiy/bb8bot/logging"
+	"github.com/nlopes/slack"
+	"golang.org/x/crypto/ssh"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -26,10 +32,12 @@ func TestCreateMessage(t *testing.T) {
 		{"0123456789\n0123456789\n0123456789", 30, 5, []string{"0123456789\n0123456789", "0123456789"}},
 		{"0123456789\n", 10, 5, []string{"0123456789"}},
 		{"0123456789\n0123456789\n", 10, 5, []string{"0123456789", "0123456789"}},
+		{"line1\nline2", 0, 0, []string{"line1\nline2"}},
+		{"line1\nline2\nline3", 8, 0, []string{"line1", "line2", "line3"}},
 	}
 
 	for i, test := range tests {
-		msgs := createMessages(test.output, test.maxSymbolsPerMessage, test.maxMessages)
+		msgs := outputMessages(test.output, false, test.maxSymbolsPerMessage, test.maxMessages)
 		if !reflect.DeepEqual(msgs, test.msgs) {
 			t.Errorf("%d: Got msgs: %q, want: %q", i, msgs, test.msgs)
 		}
@@ -60,13 +68,25 @@ func TestParseAction(t *testing.T) {
 			"group",
 			"",
 			"",
-			errors.New("group *group* not found\nbot help"),
+			errors.New("group help"),
 		},
 		{
-			"group",
+			"grop",
+			"",
+			"",
+			errors.New("group *grop* not found, did you mean `group1`?\nbot help"),
+		},
+		{
+			"nothing",
 			"",
 			"",
-			errors.New("group *group* not found\nbot help"),
+			errors.New("group *nothing* not found\nbot help"),
+		},
+		{
+			"<!here>",
+			"",
+			"",
+			errors.New("group *&lt;!here&gt;* not found\nbot help"),
 		},
 		{
 			"group1",
@@ -134,26 +154,65 @@ func TestParseAction(t *testing.T) {
 			"onehost",
 			nil,
 		},
+		{
+			"group1 comm",
+			"",
+			"",
+			errors.New("command *comm* not found, did you mean `command1` or `command2`?\ngroup help"),
+		},
+		{
+			"group1 comand2 arg",
+			"",
+			"",
+			errors.New("command *comand2* not found, did you mean `command2` or `command1`?\ngroup help"),
+		},
+		{
+			"gr command2 arg-name",
+			"raw command2 arg-value",
+			"onehost",
+			nil,
+		},
+		{
+			"group1 command2 arg",
+			"",
+			"",
+			errors.New("argument value *arg* not found, did you mean `arg-name`?\ncommand2 help"),
+		},
+		{
+			"group1 command2 arg-nmae",
+			"",
+			"",
+			errors.New("argument value *arg-nmae* not found, did you mean `arg-name`?\ncommand2 help"),
+		},
+		{
+			"group1 command1 | grep x | head 5",
+			"raw command1",
+			"onehost",
+			nil,
+		},
+		{
+			"group1 command1 | rm -rf /",
+			"",
+			"",
+			errors.New("bad filter: unknown filter *rm*, available: grep, head, tail, wc, sort, cut"),
+		},
 	}
 
 	conf := makeTestConfig()
 
 	for i, test := range tests {
-		cmd, _, host, err := parseAction(test.action, conf)
+		a, err := parseAction(test.action, conf)
 		if !reflect.DeepEqual(err, test.err) {
 			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
 		}
-		var c string
-		if cmd != nil {
-			c = *cmd
+		var c, h string
+		if a != nil {
+			c = rawCmds(a)
+			h = hostIds(a.hosts)
 		}
 		if !reflect.DeepEqual(c, test.cmd) {
 			t.Errorf("%d: Got cmd: %q, want: %q", i, c, test.cmd)
 		}
-		var h string
-		if host != nil {
-			h = host.Id
-		}
 		if !reflect.DeepEqual(h, test.host) {
 			t.Errorf("%d: Got host: %q, want: %q", i, h, test.host)
 		}
@@ -162,6 +221,210 @@ func TestParseAction(t *testing.T) {
 
 }
 
+func TestParseActionTags(t *testing.T) {
+
+	tests := []struct {
+		action string
+		cmd    string
+		hosts  string
+		err    error
+	}{
+		{
+			"tagged @web disk",
+			"df -h,df -h",
+			"web-eu,web-us",
+			nil,
+		},
+		{
+			"tagged @web,eu disk",
+			"df -h",
+			"web-eu",
+			nil,
+		},
+		{
+			"tagged @db disk",
+			"",
+			"",
+			errors.New("hosts with tags *db* not found\ntagged help"),
+		},
+		{
+			"tagged @web prod-only",
+			"prod-only",
+			"web-us",
+			nil,
+		},
+		{
+			"tagged web-eu prod-only",
+			"",
+			"",
+			errors.New("command *prod-only* is not allowed on *web-eu*\nprod-only help"),
+		},
+		{
+			"tagged web-eu disk",
+			"df -h",
+			"web-eu",
+			nil,
+		},
+		{
+			"tagged web-e disk",
+			"df -h",
+			"web-eu",
+			nil,
+		},
+		{
+			"tagged web disk",
+			"",
+			"",
+			errors.New("host *web* not found, did you mean `web-eu` or `web-us`?\ntagged help"),
+		},
+		{
+			"tagged wbe-us disk",
+			"",
+			"",
+			errors.New("host *wbe-us* not found, did you mean `web-us`?\ntagged help"),
+		},
+		{
+			"tagged web-e di",
+			"",
+			"",
+			errors.New("command *di* not found, did you mean `disk`?\ntagged help"),
+		},
+		{
+			"tagged @ disk",
+			"",
+			"",
+			errors.New("hosts tags are not set\ntagged help"),
+		},
+	}
+
+	conf := makeTestConfig()
+	prod, err := config.ParseSelector("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := map[string]*config.Host{
+		"web-eu": {Id: "web-eu", Tags: []string{"web", "eu"}},
+		"web-us": {Id: "web-us", Tags: []string{"web", "us", "prod"}},
+	}
+	for id, h := range hosts {
+		conf.Hosts[id] = h
+	}
+	conf.Groups["tagged"] = &config.Group{
+		Id:    "tagged",
+		Help:  "tagged help",
+		Hosts: hosts,
+		Commands: map[string]*config.Command{
+			"disk":      {Id: "disk", Help: "disk help", Format: "df -h"},
+			"prod-only": {Id: "prod-only", Help: "prod-only help", Format: "prod-only", Selector: prod},
+		},
+	}
+
+	for i, test := range tests {
+		a, err := parseAction(test.action, conf)
+		if !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+		}
+		var c, h string
+		if a != nil {
+			c = rawCmds(a)
+			h = hostIds(a.hosts)
+		}
+		if c != test.cmd {
+			t.Errorf("%d: Got cmd: %q, want: %q", i, c, test.cmd)
+		}
+		if h != test.hosts {
+			t.Errorf("%d: Got hosts: %q, want: %q", i, h, test.hosts)
+		}
+	}
+}
+
+func TestParseActionCommandPrefixes(t *testing.T) {
+	conf := makeTestConfig()
+	conf.Settings.CommandPrefixes = true
+
+	tests := []struct {
+		action string
+		cmd    string
+		err    error
+	}{
+		{"group1 command2 arg", "raw command2 arg-value", nil},
+		{"gr command2 arg-n", "raw command2 arg-value", nil},
+		{"group1 command1", "raw command1", nil},
+		{"group1 comm", "", errors.New("command *comm* not found, did you mean `command1` or `command2`?\ngroup help")},
+		{"group1 command2 arg-nmae", "", errors.New("argument value *arg-nmae* not found, did you mean `arg-name`?\ncommand2 help")},
+	}
+	for i, test := range tests {
+		a, err := parseAction(test.action, conf)
+		if !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+		}
+		var c string
+		if a != nil {
+			c = rawCmds(a)
+		}
+		if c != test.cmd {
+			t.Errorf("%d: Got cmd: %q, want: %q", i, c, test.cmd)
+		}
+	}
+}
+
+func TestParseActionAliases(t *testing.T) {
+	conf := makeTestConfig()
+	conf.Groups["group1"].Aliases = []string{"g1", "g"}
+	conf.Groups["group1"].Commands["command2"].Aliases = []string{"c2"}
+	conf.Aliases = map[string]string{"short": "group1 command2 arg-name", "g1c": "g1 c2"}
+
+	tests := []struct {
+		action string
+		cmd    string
+		filter string
+		err    error
+	}{
+		{"g1 c2 arg-name", "raw command2 arg-value", "", nil},
+		{"g onehost command2 arg-name", "raw command2 arg-value", "", nil},
+		{"group1 c2 help", "", "", errors.New("command2 help")},
+		{"short", "raw command2 arg-value", "", nil},
+		{"short | head 5", "raw command2 arg-value", "head 5", nil},
+		{"g1c arg-name", "raw command2 arg-value", "", nil},
+		{"g1 c3", "", "", errors.New("command *c3* not found, did you mean `c2`?\ngroup help")},
+	}
+	for i, test := range tests {
+		a, err := parseAction(test.action, conf)
+		if !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+		}
+		var c, f string
+		if a != nil {
+			c = rawCmds(a)
+			if a.filter != nil {
+				f = a.filter.Text
+			}
+		}
+		if c != test.cmd {
+			t.Errorf("%d: Got cmd: %q, want: %q", i, c, test.cmd)
+		}
+		if f != test.filter {
+			t.Errorf("%d: Got filter: %q, want: %q", i, f, test.filter)
+		}
+	}
+}
+
+func rawCmds(a *action) string {
+	cmds := make([]string, len(a.hosts))
+	for i, h := range a.hosts {
+		cmds[i] = a.rawCmds[h.Id]
+	}
+	return strings.Join(cmds, ",")
+}
+
+func hostIds(hosts []*config.Host) string {
+	ids := make([]string, len(hosts))
+	for i, h := range hosts {
+		ids[i] = h.Id
+	}
+	return strings.Join(ids, ",")
+}
+
 func makeTestConfig() *config.Config {
 
 	hosts := make(map[string]*config.Host)
@@ -225,3 +488,105 @@ func makeTestConfig() *config.Config {
 
 	return conf
 }
+
+func TestExecuteLogs(t *testing.T) {
+	conf := makeTestConfig()
+	a, err := parseAction("group1 command1", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	log := logging.New(&buf, logging.Info, logging.Text)
+	log.SetSecrets(conf.Secrets())
+	a.log = log.With("request_id", newRequestID())
+	a.execute(a.hosts[0], func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+		return nil, errors.New("ssh: unable to authenticate with password gayjke")
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Got logs: %q", lines)
+	}
+	if !regexp.MustCompile(` INFO  Execute command request_id=[0-9a-f]{16} group=group1 command=command1 host=onehost address=onehost:22 cmd="raw command1"$`).MatchString(lines[0]) {
+		t.Errorf("Got log: %q", lines[0])
+	}
+	if !regexp.MustCompile(` ERROR Command failed request_id=[0-9a-f]{16} group=group1 command=command1 host=onehost err="ssh: unable to authenticate with password \[REDACTED\]"$`).MatchString(lines[1]) {
+		t.Errorf("Got log: %q", lines[1])
+	}
+}
+
+func TestRunActionFilter(t *testing.T) {
+	conf := makeTestConfig()
+	run := func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+		return &result{output: "a 1\nb 2\nc 3\n"}, nil
+	}
+	tests := []struct {
+		action string
+		msgs   []string
+	}{
+		{"group1 command1", []string{"a 1\nb 2\nc 3"}},
+		{"group1 command1 | grep -v b | cut -f 2", []string{"1\n3"}},
+		{"group1 command1 | grep d", []string{"_Nothing left after_ `grep d`"}},
+		{"group1 command1 | grep 'a|c' | cut -f 2", []string{"1\n3"}},
+		{"group1 command1 | grep '<!here>'", []string{"_Nothing left after_ `grep '&lt;!here&gt;'`"}},
+	}
+	for i, test := range tests {
+		a, err := parseAction(test.action, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msgs []string
+		results := runAction(a, run, func(msg string, blocks ...slack.Block) { msgs = append(msgs, msg) })
+		if !reflect.DeepEqual(msgs, test.msgs) {
+			t.Errorf("%d: Got msgs: %q, want: %q", i, msgs, test.msgs)
+		}
+		if results[0].Output != "a 1\nb 2\nc 3\n" {
+			t.Errorf("%d: Got stored output: %q", i, results[0].Output)
+		}
+	}
+}
+
+func TestRunActionRedaction(t *testing.T) {
+	conf := makeTestConfig()
+	conf.Settings.Redactions = []*regexp.Regexp{regexp.MustCompile(`sk_live_\w+`)}
+	run := func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+		return &result{output: "\x1b[32mSTRIPE=sk_live_abc\x1b[0m\nDB_PASSWORD=hunter2\nHOME=/root\n"}, nil
+	}
+	a, err := parseAction("group1 command1", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	results := runAction(a, run, func(msg string, blocks ...slack.Block) { msgs = append(msgs, msg) })
+	want := []string{"STRIPE=[REDACTED]\nDB_PASSWORD=[REDACTED]\nHOME=/root", "_2 secrets were redacted from the output_"}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("Got msgs: %q, want: %q", msgs, want)
+	}
+	if want := "STRIPE=[REDACTED]\nDB_PASSWORD=[REDACTED]\nHOME=/root\n"; results[0].Output != want {
+		t.Errorf("Got stored output: %q, want: %q", results[0].Output, want)
+	}
+}
+
+func TestRunActionExitError(t *testing.T) {
+	conf := makeTestConfig()
+	run := func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+		return &result{output: "DB_PASSWORD=hunter2\n<!channel>\n", exitCode: 1, exitErr: &ssh.ExitError{}}, nil
+	}
+	a, err := parseAction("group1 command1", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	results := runAction(a, run, func(msg string, blocks ...slack.Block) { msgs = append(msgs, msg) })
+	want := []string{
+		"error execution action: error calling ssh command: Process exited with status 0",
+		"DB_PASSWORD=[REDACTED]\n&lt;!channel&gt;",
+		"_1 secret was redacted from the output_",
+	}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("Got msgs: %q, want: %q", msgs, want)
+	}
+	if results[0].ExitCode != 1 || strings.Contains(results[0].Output, "hunter2") {
+		t.Errorf("Got stored result: %+v", results[0])
+	}
+}
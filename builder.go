@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/nlopes/slack"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxInteractionSize is the limit of the Slack interactivity request body
+const maxInteractionSize = 1 << 20
+
+// maxSelectOptions is the Slack limit of static select options
+const maxSelectOptions = 100
+
+// maxActionElements is the Slack limit of elements in the actions block
+const maxActionElements = 5
+
+// maxButtonValue is the Slack limit of the button value length
+const maxButtonValue = 2000
+
+// Builder action ids
+const (
+	builderHost    = "host"
+	builderCommand = "command"
+	builderArg     = "arg_"
+	builderRun     = "run"
+	builderCancel  = "cancel"
+)
+
+// builder handles Slack interactivity payloads of the command builder messages
+type builder struct {
+	bot   *bot
+	async func(f func())
+}
+
+// builderState is the builder selection, it is stored in the run button value of the builder message
+type builderState struct {
+	Group   string   `json:"g"`
+	Host    string   `json:"h,omitempty"`
+	Command string   `json:"c,omitempty"`
+	Args    []string `json:"a,omitempty"`
+}
+
+// newBuilder returns the command builder running actions in goroutines
+func newBuilder(b *bot) *builder {
+	return &builder{bot: b, async: func(f func()) { go f() }}
+}
+
+// register adds the Slack interactivity route to the mux
+func (bl *builder) register(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/slack/interactions", bl.handleInteraction)
+}
+
+// builderEnabled reports whether the Slack signing secret is set, so interactivity requests could be verified
+func builderEnabled(conf *config.Config) bool {
+	return conf.Settings.HTTP != nil && conf.Settings.HTTP.SigningSecret != ""
+}
+
+// handleInteraction verifies the Slack request signature, acknowledges the payload and handles it
+func (bl *builder) handleInteraction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	conf := bl.bot.store.Load()
+	if !builderEnabled(conf) {
+		http.Error(w, "interactivity is disabled", http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxInteractionSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return
+	}
+	verifier, err := slack.NewSecretsVerifier(r.Header, conf.Settings.HTTP.SigningSecret)
+	if err == nil {
+		verifier.Write(body)
+		err = verifier.Ensure()
+	}
+	if err != nil {
+		logger.Warn("Slack request with bad signature", "remote", r.RemoteAddr, "err", err)
+		permissionDenials.WithLabelValues("builder", "signature").Inc()
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %v", err), http.StatusBadRequest)
+		return
+	}
+	var cb slack.InteractionCallback
+	if err := json.Unmarshal([]byte(values.Get("payload")), &cb); err != nil {
+		http.Error(w, fmt.Sprintf("bad payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if cb.Type != slack.InteractionTypeBlockActions || len(cb.ActionCallback.BlockActions) == 0 {
+		return
+	}
+	bl.async(func() {
+		bl.handleBlockAction(&cb, conf)
+	})
+}
+
+// handleBlockAction updates the builder message with the selection or runs the built action
+func (bl *builder) handleBlockAction(cb *slack.InteractionCallback, conf *config.Config) {
+	ba := cb.ActionCallback.BlockActions[0]
+	user, channel, ts := cb.User.ID, cb.Channel.ID, cb.Message.Timestamp
+	log := logger.With("request_id", newRequestID(), "user", user, "channel", channel)
+	state, ok := messageState(cb.Message.Blocks.BlockSet)
+	if !ok {
+		log.Warn("Bad builder message", "action_id", ba.ActionID)
+		return
+	}
+	req := &chatRequest{user: user, channel: channel, log: log}
+	reply := func(msg string, blocks ...slack.Block) {
+		bl.bot.post(channel, msg, blocks...)
+	}
+	// the builder message is shared by the channel, so it's changed only by permitted users
+	if denied := checkPermissions(req, conf, "builder"); denied != "" {
+		reply(denied)
+		return
+	}
+	group, exist := conf.Groups[state.Group]
+	if !exist {
+		bl.bot.update(channel, ts, fmt.Sprintf("group *%s* not found", mrkdwnEscaper.Replace(state.Group)))
+		return
+	}
+
+	note := ""
+	prev := state
+	switch {
+	case ba.ActionID == builderCancel:
+		bl.bot.update(channel, ts, "_Cancelled_", textBlock(fmt.Sprintf("_Cancelled_ by <@%s>", user)))
+		return
+	case ba.ActionID == builderHost:
+		state.Host = ba.SelectedOption.Value
+	case ba.ActionID == builderCommand:
+		if state.Command != ba.SelectedOption.Value {
+			state.Command = ba.SelectedOption.Value
+			state.Args = nil
+		}
+	case strings.HasPrefix(ba.ActionID, builderArg):
+		i, err := strconv.Atoi(strings.TrimPrefix(ba.ActionID, builderArg))
+		command, exist := group.Commands[state.Command]
+		if err != nil || !exist || i < 0 || i >= len(command.Arguments) {
+			log.Warn("Bad builder action", "action_id", ba.ActionID)
+			return
+		}
+		args := make([]string, len(command.Arguments))
+		copy(args, state.Args)
+		args[i] = ba.SelectedOption.Value
+		state.Args = args
+	case ba.ActionID == builderRun:
+		text, complete := state.text(group)
+		if !complete {
+			note = "Select the host, the command and all its arguments"
+			break
+		}
+		escaped := codeEscaper.Replace(text)
+		bl.bot.update(channel, ts, "_Run_ `"+escaped+"`", textBlock(fmt.Sprintf("_Run_ `%s` by <@%s>", escaped, user)))
+		bl.bot.handleAction(req, text, conf, reply)
+		return
+	default:
+		log.Warn("Bad builder action", "action_id", ba.ActionID)
+		return
+	}
+	if value, _ := json.Marshal(state); len(value) > maxButtonValue {
+		state, note = prev, "The selection is too long for the builder, mention the bot with the action instead"
+	}
+	bl.bot.update(channel, ts, group.Help, builderBlocks(group, &state, note)...)
+}
+
+// messageState returns the selection stored in the run button value of the builder message blocks
+func messageState(blocks []slack.Block) (builderState, bool) {
+	var state builderState
+	for _, block := range blocks {
+		a, ok := block.(*slack.ActionBlock)
+		if !ok {
+			continue
+		}
+		for _, e := range a.Elements.ElementSet {
+			if b, ok := e.(*slack.ButtonBlockElement); ok && b.ActionID == builderRun {
+				return state, json.Unmarshal([]byte(b.Value), &state) == nil
+			}
+		}
+	}
+	return state, false
+}
+
+// text returns the chat action text for the selection and reports whether all parts are selected
+func (s *builderState) text(group *config.Group) (string, bool) {
+	parts := []string{group.Id}
+	complete := true
+	if len(group.Hosts) > 1 {
+		if _, exist := group.Hosts[s.Host]; exist {
+			parts = append(parts, s.Host)
+		} else {
+			complete = false
+		}
+	}
+	command, exist := group.Commands[s.Command]
+	if !exist {
+		return strings.Join(parts, " "), false
+	}
+	parts = append(parts, command.Id)
+	for i := range command.Arguments {
+		if i >= len(s.Args) || s.Args[i] == "" {
+			complete = false
+			continue
+		}
+		parts = append(parts, s.Args[i])
+	}
+	return strings.Join(parts, " "), complete
+}
+
+// builderBlocks returns the builder message blocks with selects for the group host, command
+// and the command arguments items, the run and cancel buttons and the note if it is set
+func builderBlocks(group *config.Group, state *builderState, note string) []slack.Block {
+	var elements []slack.BlockElement
+	if len(group.Hosts) > 1 {
+		elements = append(elements, selectElement(builderHost, "Host", sortedKeys(hostNames(group)), state.Host))
+	}
+	commands := make(map[string]string)
+	for id, c := range group.Commands {
+		if c.Format != "" {
+			commands[id] = id
+		}
+	}
+	elements = append(elements, selectElement(builderCommand, "Command", sortedKeys(commands), state.Command))
+	if command, exist := group.Commands[state.Command]; exist {
+		for i, arg := range command.Arguments {
+			items := make([]string, len(arg.Items))
+			for j, item := range arg.Items {
+				items[j] = item.Name
+			}
+			selected := ""
+			if i < len(state.Args) {
+				selected = state.Args[i]
+			}
+			placeholder := arg.Id
+			if placeholder == "" {
+				placeholder = fmt.Sprintf("Argument %d", i+1)
+			}
+			elements = append(elements, selectElement(builderArg+strconv.Itoa(i), placeholder, items, selected))
+		}
+	}
+
+	text, _ := state.text(group)
+	blocks := []slack.Block{textBlock(fmt.Sprintf("_Build_ `%s`", codeEscaper.Replace(text)))}
+	for i := 0; i < len(elements); i += maxActionElements {
+		end := i + maxActionElements
+		if end > len(elements) {
+			end = len(elements)
+		}
+		blocks = append(blocks, slack.NewActionBlock(fmt.Sprintf("builder_%d", len(blocks)), elements[i:end]...))
+	}
+	value, _ := json.Marshal(state)
+	run := slack.NewButtonBlockElement(builderRun, string(value), slack.NewTextBlockObject(slack.PlainTextType, "Run", false, false))
+	run.WithStyle(slack.StylePrimary)
+	cancel := slack.NewButtonBlockElement(builderCancel, builderCancel, slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false))
+	blocks = append(blocks, slack.NewActionBlock(fmt.Sprintf("builder_%d", len(blocks)), run, cancel))
+	if note != "" {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, note, false, false)))
+	}
+	return blocks
+}
+
+// selectElement returns the static select of values with the selected one as the initial option
+func selectElement(actionID, placeholder string, values []string, selected string) *slack.SelectBlockElement {
+	if len(values) > maxSelectOptions {
+		values = values[:maxSelectOptions]
+	}
+	options := make([]*slack.OptionBlockObject, len(values))
+	for i, v := range values {
+		options[i] = slack.NewOptionBlockObject(v, slack.NewTextBlockObject(slack.PlainTextType, v, false, false))
+	}
+	element := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, slack.NewTextBlockObject(slack.PlainTextType, placeholder, false, false), actionID, options...)
+	for _, o := range options {
+		if o.Value == selected {
+			element.InitialOption = o
+		}
+	}
+	return element
+}
+
+// textBlock returns the section block with the markdown text
+func textBlock(text string) slack.Block {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+// sortedKeys returns the names map keys in order
+func sortedKeys(names map[string]string) []string {
+	keys := make([]string, 0, len(names))
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/nlopes/slack"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	conf := makeTestConfig()
+	conf.Settings.HTTP = &config.HTTP{Listen: ":8080", SigningSecret: "signing"}
+	store := &configStore{}
+	store.current.Store(conf)
+
+	var posted []string
+	var updated string
+	var blocks []slack.Block
+	b := &bot{
+		store: store,
+		run: func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+			return &result{output: "out of " + rawCmd}, nil
+		},
+		post: func(channel, text string, b ...slack.Block) {
+			posted = append(posted, channel+": "+text)
+		},
+		update: func(channel, ts, text string, b ...slack.Block) {
+			updated = channel + " " + ts + ": " + text
+			blocks = b
+		},
+	}
+	bl := newBuilder(b)
+	bl.async = func(f func()) { f() }
+	mux := http.NewServeMux()
+	bl.register(mux)
+
+	req := &chatRequest{user: "U1", channel: "C1", log: logger}
+	b.handleAction(req, "group1", conf, func(msg string, b ...slack.Block) {
+		posted = append(posted, msg)
+		blocks = b
+	})
+	if len(posted) != 1 || posted[0] != "group help" || len(blocks) != 3 {
+		t.Fatalf("Got posted: %q, blocks: %d", posted, len(blocks))
+	}
+
+	arg := conf.Groups["group1"].Commands["command2"].Arguments[0]
+	long, tooLong := strings.Repeat("a", 300), strings.Repeat("b", maxButtonValue)
+	arg.Items = append(arg.Items, &config.Item{Name: long, Value: "long"}, &config.Item{Name: tooLong, Value: "too long"},
+		&config.Item{Name: "<b>&", Value: "b"})
+	tests := []struct {
+		actionID string
+		value    string
+		updated  string
+		posted   []string
+		note     bool
+	}{
+		{builderRun, "", "C1 1.2: group help", nil, true},
+		{builderCommand, "command2", "C1 1.2: group help", nil, false},
+		{builderRun, "", "C1 1.2: group help", nil, true},
+		{builderArg + "0", long, "C1 1.2: group help", nil, false},
+		{builderArg + "0", tooLong, "C1 1.2: group help", nil, true},
+		{builderArg + "0", "arg-name", "C1 1.2: group help", nil, false},
+		{builderRun, "", "C1 1.2: _Run_ `group1 command2 arg-name`", []string{"C1: out of raw command2 arg-value"}, false},
+	}
+	for i, test := range tests {
+		posted, updated = nil, ""
+		w := interact(mux, "signing", test.actionID, test.value, blocks)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%d: Got status: %d, body: %s", i, w.Code, w.Body.String())
+		}
+		if updated != test.updated {
+			t.Errorf("%d: Got updated: %q, want: %q", i, updated, test.updated)
+		}
+		if strings.Join(posted, "|") != strings.Join(test.posted, "|") {
+			t.Errorf("%d: Got posted: %q, want: %q", i, posted, test.posted)
+		}
+		if _, note := blocks[len(blocks)-1].(*slack.ContextBlock); note != test.note {
+			t.Errorf("%d: Got note: %v, want: %v", i, note, test.note)
+		}
+		for _, block := range blocks {
+			if a, ok := block.(*slack.ActionBlock); ok && len(a.BlockID) > 255 {
+				t.Errorf("%d: Got block id length: %d", i, len(a.BlockID))
+			}
+		}
+		if state, ok := messageState(blocks); test.posted == nil && (!ok || len(state.Args) > 0 && state.Args[0] == tooLong) {
+			t.Errorf("%d: Got state: %+v, %v", i, state, ok)
+		}
+	}
+
+	// the selected values are escaped, so they can't break the code formatting
+	b.handleAction(req, "group1", conf, func(msg string, b ...slack.Block) {
+		blocks = b
+	})
+	interact(mux, "signing", builderCommand, "command2", blocks)
+	interact(mux, "signing", builderArg+"0", "<b>&", blocks)
+	if text := blocks[0].(*slack.SectionBlock).Text.Text; text != "_Build_ `group1 command2 &lt;b&gt;&amp;`" {
+		t.Errorf("Got build text: %q", text)
+	}
+	posted = nil
+	interact(mux, "signing", builderRun, "", blocks)
+	if updated != "C1 1.2: _Run_ `group1 command2 &lt;b&gt;&amp;`" || strings.Join(posted, "|") != "C1: out of raw command2 b" {
+		t.Errorf("Got updated: %q, posted: %q", updated, posted)
+	}
+	if text := blocks[0].(*slack.SectionBlock).Text.Text; text != "_Run_ `group1 command2 &lt;b&gt;&amp;` by <@U1>" {
+		t.Errorf("Got run text: %q", text)
+	}
+
+	b.handleAction(req, "group1", conf, func(msg string, b ...slack.Block) {
+		blocks = b
+	})
+	interact(mux, "signing", builderCancel, "", blocks)
+	if updated != "C1 1.2: _Cancelled_" {
+		t.Errorf("Got updated: %q", updated)
+	}
+
+	b.handleAction(req, "group1", conf, func(msg string, b ...slack.Block) {
+		blocks = b
+	})
+	conf.Settings.Users = map[string]struct{}{"U2": {}}
+	for _, actionID := range []string{builderCommand, builderCancel} {
+		posted, updated = nil, ""
+		interact(mux, "signing", actionID, "command1", blocks)
+		if updated != "" || strings.Join(posted, "|") != "C1: You don't have enough permissions" {
+			t.Errorf("Got updated by denied user: %q, posted: %q", updated, posted)
+		}
+	}
+	conf.Settings.Users = nil
+
+	updated = ""
+	if w := interact(mux, "other", builderRun, "", blocks); w.Code != http.StatusUnauthorized || updated != "" {
+		t.Errorf("Got status for bad signature: %d, updated: %q", w.Code, updated)
+	}
+	r := httptest.NewRequest("GET", "/v1/slack/interactions", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Got status for GET: %d", w.Code)
+	}
+	conf.Settings.HTTP.SigningSecret = ""
+	if w := interact(mux, "signing", builderRun, "", blocks); w.Code != http.StatusNotFound {
+		t.Errorf("Got status for disabled builder: %d", w.Code)
+	}
+}
+
+func TestBuilderText(t *testing.T) {
+	conf := makeTestConfig()
+	group := conf.Groups["group1"]
+	tests := []struct {
+		state    builderState
+		text     string
+		complete bool
+	}{
+		{builderState{Group: "group1"}, "group1", false},
+		{builderState{Group: "group1", Command: "command1"}, "group1 command1", true},
+		{builderState{Group: "group1", Command: "command2"}, "group1 command2", false},
+		{builderState{Group: "group1", Command: "command2", Args: []string{"arg-name"}}, "group1 command2 arg-name", true},
+		{builderState{Group: "group1", Command: "none"}, "group1", false},
+	}
+	for i, test := range tests {
+		text, complete := test.state.text(group)
+		if text != test.text || complete != test.complete {
+			t.Errorf("%d: Got text: %q, complete: %v, want: %q, %v", i, text, complete, test.text, test.complete)
+		}
+	}
+
+	group.Hosts = map[string]*config.Host{"onehost": {Id: "onehost"}, "twohost": {Id: "twohost"}}
+	state := builderState{Group: "group1", Command: "command1"}
+	if text, complete := state.text(group); text != "group1 command1" || complete {
+		t.Errorf("Got text without host: %q, complete: %v", text, complete)
+	}
+	state.Host = "twohost"
+	if text, complete := state.text(group); text != "group1 twohost command1" || !complete {
+		t.Errorf("Got text with host: %q, complete: %v", text, complete)
+	}
+	blocks := builderBlocks(group, &state, "")
+	actions := blocks[1].(*slack.ActionBlock)
+	if len(actions.Elements.ElementSet) != 2 {
+		t.Fatalf("Got elements: %d, want: 2", len(actions.Elements.ElementSet))
+	}
+	host := actions.Elements.ElementSet[0].(*slack.SelectBlockElement)
+	if len(host.Options) != 2 || host.InitialOption == nil || host.InitialOption.Value != "twohost" {
+		t.Errorf("Got host select: %+v", host)
+	}
+}
+
+// interact sends the signed block actions payload for the action of the builder message blocks
+func interact(mux *http.ServeMux, secret, actionID, value string, blocks []slack.Block) *httptest.ResponseRecorder {
+	blockID := ""
+	for _, block := range blocks {
+		if a, ok := block.(*slack.ActionBlock); ok {
+			blockID = a.BlockID
+		}
+	}
+	action := map[string]interface{}{"action_id": actionID, "block_id": blockID, "type": "button", "value": actionID}
+	if value != "" {
+		action["type"] = "static_select"
+		action["selected_option"] = map[string]interface{}{"value": value}
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":    "block_actions",
+		"user":    map[string]string{"id": "U1"},
+		"channel": map[string]string{"id": "C1"},
+		"message": map[string]interface{}{"ts": "1.2", "text": "group help", "blocks": blocks},
+		"actions": []interface{}{action},
+	})
+	body := url.Values{"payload": {string(payload)}}.Encode()
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("v0:%s:%s", ts, body)))
+
+	r := httptest.NewRequest("POST", "/v1/slack/interactions", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
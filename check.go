@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"github.com/karlovskiy/bb8bot/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkTick is the period of checking checks intervals
+const checkTick = 5 * time.Second
+
+// checker periodically runs config checks and posts to the check channel only when the state changes
+type checker struct {
+	bot     *bot
+	run     runFunc
+	mu      sync.Mutex
+	states  map[string]*checkState
+	running map[string]bool
+}
+
+// checkState is the confirmed state of the check on the host and the pending state
+// that becomes confirmed after the check's number of consecutive results
+type checkState struct {
+	host    string
+	state   string
+	value   float64
+	err     error
+	since   time.Time
+	pending string
+	count   int
+}
+
+// newChecker returns the checker running commands over ssh
+func newChecker(b *bot) *checker {
+	return &checker{
+		bot:     b,
+		run:     runCommand,
+		states:  make(map[string]*checkState),
+		running: make(map[string]bool),
+	}
+}
+
+// loop runs checks when their intervals pass, a check is never run concurrently with itself
+func (c *checker) loop() {
+	started := make(map[string]time.Time)
+	for {
+		for _, check := range c.bot.store.Load().Checks {
+			if time.Since(started[check.Id]) < check.Interval || c.isRunning(check.Id) {
+				continue
+			}
+			started[check.Id] = time.Now()
+			c.setRunning(check.Id, true)
+			go func(id string) {
+				defer c.setRunning(id, false)
+				c.check(id)
+			}(check.Id)
+		}
+		time.Sleep(checkTick)
+	}
+}
+
+func (c *checker) isRunning(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running[id]
+}
+
+func (c *checker) setRunning(id string, running bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running[id] = running
+}
+
+// check runs the check action from the current config on all its hosts and posts state changes
+func (c *checker) check(id string) {
+	conf := c.bot.store.Load()
+	check := findCheck(conf, id)
+	if check == nil {
+		logger.Warn("Check not found", "check", id)
+		return
+	}
+	log := logger.With("request_id", newRequestID(), "check", id)
+	log.Debug("Run check", "action", check.Action())
+	a, err := parseAction(check.Action(), conf)
+	if err != nil {
+		c.report(check, "", config.CheckUnknown, 0, err)
+		return
+	}
+	a.log = log
+	for _, host := range a.hosts {
+		res, err := a.execute(host, c.run)
+		if err == nil {
+			err = res.exitError()
+		}
+		if err != nil {
+			c.report(check, host.Id, config.CheckUnknown, 0, err)
+			continue
+		}
+		// stderr warnings like ssh banners or locale ones could break thresholds, so only stdout is evaluated
+		state, value, err := check.Evaluate(res.stdout)
+		c.report(check, host.Id, state, value, err)
+	}
+}
+
+// report updates the check state on the host and posts the message if the state was changed
+func (c *checker) report(check *config.Check, host string, state string, value float64, err error) {
+	if err != nil {
+		logger.Warn("Check failed", "check", check.Id, "host", host, "err", err)
+	}
+	c.mu.Lock()
+	key := check.Id + "/" + host
+	s, exist := c.states[key]
+	if !exist {
+		s = &checkState{host: host, state: config.CheckOK, since: time.Now()}
+		c.states[key] = s
+	}
+	previous := s.state
+	changed := s.update(state, check.Confirm)
+	s.value, s.err = value, err
+	c.mu.Unlock()
+	if changed {
+		c.bot.post(check.Channel, checkMessage(check, host, previous, state, value, err))
+	}
+}
+
+// update returns true if the new state is confirmed by the required number of consecutive results
+func (s *checkState) update(state string, confirm int) bool {
+	if state == s.state {
+		s.pending, s.count = "", 0
+		return false
+	}
+	if state != s.pending {
+		s.pending, s.count = state, 0
+	}
+	s.count++
+	if s.count < confirm {
+		return false
+	}
+	s.state, s.since = state, time.Now()
+	s.pending, s.count = "", 0
+	return true
+}
+
+// checkMessage returns the chat message about the check state change
+func checkMessage(check *config.Check, host, previous, state string, value float64, err error) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%s *%s* `%s`", checkIcons[state], state, check.Id))
+	if host != "" {
+		b.WriteString(fmt.Sprintf(" on *%s*", host))
+	}
+	if err != nil {
+		b.WriteString(fmt.Sprintf(": %v", err))
+		return b.String()
+	}
+	b.WriteString(fmt.Sprintf(": %v%s", value, thresholds(check)))
+	if state == config.CheckOK {
+		b.WriteString(fmt.Sprintf(", recovered from %s", previous))
+	}
+	return b.String()
+}
+
+// thresholds returns the check thresholds description like " (warn 80, crit 90)"
+func thresholds(check *config.Check) string {
+	var parts []string
+	if check.Warn != nil {
+		parts = append(parts, fmt.Sprintf("warn %v", *check.Warn))
+	}
+	if check.Crit != nil {
+		parts = append(parts, fmt.Sprintf("crit %v", *check.Crit))
+	}
+	if check.Below {
+		parts = append(parts, "below")
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+var checkIcons = map[string]string{
+	config.CheckOK:      ":white_check_mark:",
+	config.CheckWarn:    ":warning:",
+	config.CheckCrit:    ":red_circle:",
+	config.CheckUnknown: ":grey_question:",
+}
+
+// list returns checks with their current states by host
+func (c *checker) list() string {
+	conf := c.bot.store.Load()
+	if len(conf.Checks) == 0 {
+		return "No checks"
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("_*Checks:*_")
+	for _, check := range conf.Checks {
+		b.WriteString(fmt.Sprintf("\n`%s`   `%s` every %s%s to <#%s>", check.Id, check.Action(), check.Interval, thresholds(check), check.Channel))
+		var states []*checkState
+		for key, s := range c.states {
+			if strings.HasPrefix(key, check.Id+"/") {
+				states = append(states, s)
+			}
+		}
+		sort.Slice(states, func(i, j int) bool {
+			return states[i].host < states[j].host
+		})
+		for _, s := range states {
+			b.WriteString(fmt.Sprintf("\n    %s *%s*", checkIcons[s.state], s.state))
+			if s.host != "" {
+				b.WriteString(fmt.Sprintf(" on *%s*", s.host))
+			}
+			if s.err == nil {
+				b.WriteString(fmt.Sprintf(": %v", s.value))
+			}
+			b.WriteString(fmt.Sprintf("   _since %s_", s.since.Format("2006-01-02 15:04 MST")))
+		}
+	}
+	return b.String()
+}
+
+// findCheck returns the config check by id or nil if it doesn't exist
+func findCheck(conf *config.Config, id string) *config.Check {
+	for _, check := range conf.Checks {
+		if check.Id == id {
+			return check
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/nlopes/slack"
+	"strings"
+	"testing"
+)
+
+func TestChecker(t *testing.T) {
+	warn, crit := 80.0, 90.0
+	conf := makeTestConfig()
+	conf.Checks = []*config.Check{{
+		Id:      "load",
+		Group:   "group1",
+		Command: "command1",
+		Channel: "C1",
+		Warn:    &warn,
+		Crit:    &crit,
+		Confirm: 2,
+	}}
+	store := &configStore{}
+	store.current.Store(conf)
+
+	var posted []string
+	b := &bot{
+		store: store,
+		post: func(channel, text string, blocks ...slack.Block) {
+			posted = append(posted, channel+": "+text)
+		},
+	}
+	c := newChecker(b)
+
+	tests := []struct {
+		output string
+		stderr string
+		err    error
+		posted string
+	}{
+		{"10", "", nil, ""},
+		{"95", "", nil, ""},
+		{"10", "", nil, ""},
+		{"95", "", nil, ""},
+		{"95", "", nil, "C1: :red_circle: *CRIT* `load` on *onehost*: 95 (warn 80, crit 90)"},
+		{"85", "", nil, ""},
+		{"85", "", nil, "C1: :warning: *WARN* `load` on *onehost*: 85 (warn 80, crit 90)"},
+		{"", "", errors.New("connection refused"), ""},
+		{"", "", errors.New("connection refused"), "C1: :grey_question: *UNKNOWN* `load` on *onehost*: connection refused"},
+		{"1", "", nil, ""},
+		{"1", "", nil, "C1: :white_check_mark: *OK* `load` on *onehost*: 1 (warn 80, crit 90), recovered from UNKNOWN"},
+		{"2", "perl: warning: Setting locale failed, 99 times\n", nil, ""},
+		{"2", "perl: warning: Setting locale failed, 99 times\n", nil, ""},
+	}
+	for i, test := range tests {
+		posted = nil
+		c.run = func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+			if rawCmd != "raw command1" {
+				t.Errorf("%d: Got raw command: %q", i, rawCmd)
+			}
+			return &result{output: test.stderr + test.output, stdout: test.output, stderr: test.stderr}, test.err
+		}
+		c.check("load")
+		var got string
+		if len(posted) > 0 {
+			got = strings.Join(posted, "\n")
+		}
+		if got != test.posted {
+			t.Errorf("%d: Got posted: %q, want: %q", i, got, test.posted)
+		}
+	}
+
+	if list := c.list(); !strings.Contains(list, "`load`   `group1 command1` every 0s (warn 80, crit 90) to <#C1>\n    :white_check_mark: *OK* on *onehost*: 2   _since ") {
+		t.Errorf("Got list: %q", list)
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reservedNames are the bot commands and keywords which can't be used as groups ids and aliases
+var reservedNames = []string{"help", "reload", "schedules", "schedule", "checks", "history", "show", "rerun", "diff", "!!"}
+
+// FindGroup returns the group by id or alias
+func (c *Config) FindGroup(name string) (*Group, bool) {
+	if g, exist := c.Groups[name]; exist {
+		return g, true
+	}
+	for _, g := range c.Groups {
+		for _, alias := range g.Aliases {
+			if alias == name {
+				return g, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// FindCommand returns the group command by id or alias
+func (g *Group) FindCommand(name string) (*Command, bool) {
+	if c, exist := g.Commands[name]; exist {
+		return c, true
+	}
+	for _, c := range g.Commands {
+		for _, alias := range c.Aliases {
+			if alias == name {
+				return c, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// ExpandAlias replaces the leading action alias with its action, the rest of the text is kept,
+// so "webdisk | head 5" is expanded to "unix web1 disk | head 5"
+func (c *Config) ExpandAlias(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return text
+	}
+	run, exist := c.Aliases[fields[0]]
+	if !exist {
+		return text
+	}
+	return run + strings.TrimPrefix(strings.TrimSpace(text), fields[0])
+}
+
+// aliasHelp returns the aliases suffix for help lines
+func aliasHelp(aliases []string) string {
+	if len(aliases) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (`%s`)", strings.Join(aliases, "`, `"))
+}
+
+// isReserved reports whether the name is the bot command or keyword
+func isReserved(name string) bool {
+	for _, reserved := range reservedNames {
+		if name == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// names tracks used names to detect collisions of ids and aliases
+type names map[string]string
+
+// add registers the name used by the owner, like `group "unix"`, and fails if it is reserved or already used
+func (n names) add(name, owner string) error {
+	if name == "" {
+		return fmt.Errorf("%s: empty alias", owner)
+	}
+	if isReserved(name) {
+		return fmt.Errorf("%s: alias %q is reserved", owner, name)
+	}
+	if used, exist := n[name]; exist {
+		return fmt.Errorf("%s: alias %q collides with %s", owner, name, used)
+	}
+	n[name] = owner
+	return nil
+}
+
+// validateGroupAliases checks that groups aliases don't collide with groups ids and other aliases
+// and commands aliases don't collide with commands ids and other aliases of the group
+func validateGroupAliases(internal *config) error {
+	groupNames := make(names)
+	for _, g := range internal.Groups {
+		groupNames[g.Id] = fmt.Sprintf("group %q", g.Id)
+	}
+	for _, g := range internal.Groups {
+		owner := fmt.Sprintf("group %q%s", g.Id, in(g.source))
+		for _, alias := range g.Aliases {
+			if err := groupNames.add(alias, owner); err != nil {
+				return err
+			}
+		}
+		commandNames := make(names)
+		for _, c := range g.Commands {
+			commandNames[c.Id] = fmt.Sprintf("command %q", c.Id)
+		}
+		for _, c := range g.Commands {
+			for _, alias := range c.Aliases {
+				if err := commandNames.add(alias, fmt.Sprintf("%s: command %q", owner, c.Id)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// buildAliases returns the actions aliases, nil if they are not set.
+// Aliases can't collide with groups ids and aliases and must run group actions, not other aliases.
+func buildAliases(internal *config, external *Config) (map[string]string, error) {
+	if len(internal.Aliases) == 0 {
+		return nil, nil
+	}
+	used := make(names)
+	for id, g := range external.Groups {
+		used[id] = fmt.Sprintf("group %q", id)
+		for _, alias := range g.Aliases {
+			used[alias] = fmt.Sprintf("group %q alias", id)
+		}
+	}
+	aliases := make(map[string]string, len(internal.Aliases))
+	for _, a := range internal.Aliases {
+		owner := fmt.Sprintf("alias %q", a.Name)
+		if err := used.add(a.Name, owner); err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(a.Run)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%s: run is not set", owner)
+		}
+		if _, exist := external.FindGroup(fields[0]); !exist {
+			return nil, fmt.Errorf("%s: group %q not found", owner, fields[0])
+		}
+		aliases[a.Name] = strings.TrimSpace(a.Run)
+	}
+	return aliases, nil
+}
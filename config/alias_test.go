@@ -0,0 +1,130 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testAliasConfig = `
+[[group]]
+    id = "unix"
+    aliases = ["u"]
+    hosts = ["web1"]
+    [[group.command]]
+        id = "memory"
+        aliases = ["mem", "m"]
+        cmdFmt = "free -th"
+    [[group.command]]
+        id = "disk"
+        cmdFmt = "df -h"
+
+[[group]]
+    id = "k8s"
+    hosts = ["web1"]
+    [[group.command]]
+        id = "pods"
+        aliases = ["m"]
+        cmdFmt = "kubectl get pods"
+
+[[host]]
+    id = "web1"
+    [host.auth]
+        type = "password"
+`
+
+func TestParseAliases(t *testing.T) {
+	conf, err := Parse(testAliasConfig + `
+[[alias]]
+    name = "webdisk"
+    run = "u web1 disk"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conf.Aliases, map[string]string{"webdisk": "u web1 disk"}) {
+		t.Errorf("Got aliases: %v", conf.Aliases)
+	}
+	if g, exist := conf.FindGroup("u"); !exist || g.Id != "unix" {
+		t.Errorf("Got group: %v", g)
+	}
+	if _, exist := conf.FindGroup("x"); exist {
+		t.Errorf("Found unknown group")
+	}
+	g := conf.Groups["unix"]
+	if c, exist := g.FindCommand("m"); !exist || c.Id != "memory" {
+		t.Errorf("Got command: %v", c)
+	}
+	if c, exist := conf.Groups["k8s"].FindCommand("m"); !exist || c.Id != "pods" {
+		t.Errorf("Got command: %v", c)
+	}
+	if !strings.Contains(g.Help, "\n`memory` (`mem`, `m`)   __") {
+		t.Errorf("Got group help: %q", g.Help)
+	}
+	if !strings.Contains(conf.Help, "\n`unix` (`u`)   __") || !strings.HasSuffix(conf.Help, "\n_*Aliases:*_\n`webdisk`   `u web1 disk`") {
+		t.Errorf("Got help: %q", conf.Help)
+	}
+
+	expands := []struct {
+		text string
+		want string
+	}{
+		{"webdisk", "u web1 disk"},
+		{"webdisk | grep sda", "u web1 disk | grep sda"},
+		{"unix memory", "unix memory"},
+		{"", ""},
+	}
+	for i, test := range expands {
+		if got := conf.ExpandAlias(test.text); got != test.want {
+			t.Errorf("%d: Got text: %q, want: %q", i, got, test.want)
+		}
+	}
+
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{
+			strings.Replace(testAliasConfig, `aliases = ["u"]`, `aliases = ["k8s"]`, 1),
+			`group "unix": alias "k8s" collides with group "k8s"`,
+		},
+		{
+			strings.Replace(testAliasConfig, `aliases = ["mem", "m"]`, `aliases = ["mem", "disk"]`, 1),
+			`group "unix": command "memory": alias "disk" collides with command "disk"`,
+		},
+		{
+			strings.Replace(testAliasConfig, `aliases = ["mem", "m"]`, `aliases = ["m", "m"]`, 1),
+			`group "unix": command "memory": alias "m" collides with group "unix": command "memory"`,
+		},
+		{
+			strings.Replace(testAliasConfig, `aliases = ["u"]`, `aliases = ["history"]`, 1),
+			`group "unix": alias "history" is reserved`,
+		},
+		{
+			testAliasConfig + "[[alias]]\nname = \"u\"\nrun = \"unix memory\"",
+			`alias "u": alias "u" collides with group "unix" alias`,
+		},
+		{
+			testAliasConfig + "[[alias]]\nname = \"a\"\nrun = \"unix memory\"\n[[alias]]\nname = \"a\"\nrun = \"unix disk\"",
+			`alias "a": alias "a" collides with alias "a"`,
+		},
+		{
+			testAliasConfig + "[[alias]]\nname = \"a\"\nrun = \"\"",
+			`alias "a": run is not set`,
+		},
+		{
+			testAliasConfig + "[[alias]]\nname = \"a\"\nrun = \"unix memory\"\n[[alias]]\nname = \"b\"\nrun = \"a\"",
+			`alias "b": group "a" not found`,
+		},
+		{
+			testAliasConfig + "[[alias]]\nname = \"\"\nrun = \"unix memory\"",
+			`alias "": empty alias`,
+		},
+	}
+	for i, test := range tests {
+		_, err := Parse(test.config)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"path"
+)
+
+// HTTP is the bot HTTP server settings
+type HTTP struct {
+	Listen  string
+	Clients []*APIClient
+	// ReadyHosts are critical hosts ids that must be reachable over ssh for readiness
+	ReadyHosts []string
+	// SigningSecret verifies Slack interactivity requests, the command builder is enabled if it is set
+	SigningSecret string
+}
+
+// APIClient is the HTTP API client with its token and allowed "group/command" patterns
+type APIClient struct {
+	Id      string
+	Token   string
+	Allow   []string
+	Channel string
+}
+
+// Client returns the API client by its token or nil if the token is unknown
+func (h *HTTP) Client(token string) *APIClient {
+	if token == "" {
+		return nil
+	}
+	for _, c := range h.Clients {
+		if subtle.ConstantTimeCompare([]byte(c.Token), []byte(token)) == 1 {
+			return c
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether the client is allowed to run the group command
+func (c *APIClient) Allowed(group, command string) bool {
+	for _, pattern := range c.Allow {
+		if ok, _ := path.Match(pattern, group+"/"+command); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// buildHTTP validates the HTTP server settings and resolves API clients tokens
+func buildHTTP(h httpSettings) (*HTTP, error) {
+	if h.Listen == "" {
+		if len(h.Clients) > 0 || len(h.ReadyHosts) > 0 || h.SigningSecret != "" || h.SigningSecretFile != "" {
+			return nil, fmt.Errorf("http: listen address is not set")
+		}
+		return nil, nil
+	}
+	signingSecret, err := resolveSecret("http: signingSecret", h.SigningSecret, h.SigningSecretFile)
+	if err != nil {
+		return nil, err
+	}
+	result := &HTTP{Listen: h.Listen, ReadyHosts: h.ReadyHosts, SigningSecret: signingSecret}
+	ids := make(map[string]struct{})
+	tokens := make(map[string]struct{})
+	for _, c := range h.Clients {
+		if c.Id == "" {
+			return nil, fmt.Errorf("http: client has empty id")
+		}
+		if _, exist := ids[c.Id]; exist {
+			return nil, fmt.Errorf("http: duplicate client id %q", c.Id)
+		}
+		ids[c.Id] = struct{}{}
+		token, err := resolveSecret("token", c.Token, c.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("http client %q: %v", c.Id, err)
+		}
+		if token == "" {
+			return nil, fmt.Errorf("http client %q: token is not set", c.Id)
+		}
+		if _, exist := tokens[token]; exist {
+			return nil, fmt.Errorf("http client %q: token is used by another client", c.Id)
+		}
+		tokens[token] = struct{}{}
+		for _, pattern := range c.Allow {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("http client %q: bad allow pattern %q", c.Id, pattern)
+			}
+		}
+		result.Clients = append(result.Clients, &APIClient{
+			Id:      c.Id,
+			Token:   token,
+			Allow:   c.Allow,
+			Channel: c.Channel,
+		})
+	}
+	return result, nil
+}
+
+// validateReadyHosts checks that readiness critical hosts exist
+func (h *HTTP) validateReadyHosts(hosts map[string]*Host) error {
+	if h == nil {
+		return nil
+	}
+	for _, id := range h.ReadyHosts {
+		if _, exist := hosts[id]; !exist {
+			return fmt.Errorf("http: ready host %q not found", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseHTTP(t *testing.T) {
+	conf, err := Parse(testScheduleConfig + `
+[settings.http]
+    listen = ":8080"
+    readyHosts = ["onehost"]
+    signingSecret = "signing"
+    [[settings.http.client]]
+        id = "ci"
+        token = "secret"
+        allow = ["unix/lsof", "db/*"]
+        channel = "C1"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := conf.Settings.HTTP
+	if h == nil || h.Listen != ":8080" || len(h.Clients) != 1 || len(h.ReadyHosts) != 1 || h.SigningSecret != "signing" {
+		t.Fatalf("Got http: %+v", h)
+	}
+	if c := h.Client("secret"); c == nil || c.Id != "ci" {
+		t.Errorf("Got client: %+v", c)
+	}
+	if c := h.Client("other"); c != nil {
+		t.Errorf("Got client for bad token: %+v", c)
+	}
+	if c := h.Client(""); c != nil {
+		t.Errorf("Got client for empty token: %+v", c)
+	}
+	c := h.Clients[0]
+	for _, allowed := range [][2]string{{"unix", "lsof"}, {"db", "status"}} {
+		if !c.Allowed(allowed[0], allowed[1]) {
+			t.Errorf("Not allowed: %v", allowed)
+		}
+	}
+	if c.Allowed("unix", "reboot") {
+		t.Errorf("Allowed unix/reboot")
+	}
+
+	tests := []struct {
+		http string
+		err  string
+	}{
+		{"[[settings.http.client]]\nid = \"ci\"\ntoken = \"t\"", "http: listen address is not set"},
+		{"signingSecret = \"s\"", "http: listen address is not set"},
+		{"listen = \":8080\"\nsigningSecret = \"s\"\nsigningSecretFile = \"/f\"", "http: signingSecret: both value and file are set"},
+		{"listen = \":8080\"\nreadyHosts = [\"none\"]", `http: ready host "none" not found`},
+		{"listen = \":8080\"\n[[settings.http.client]]\nid = \"ci\"", `http client "ci": token is not set`},
+		{"listen = \":8080\"\n[[settings.http.client]]\nid = \"ci\"\ntoken = \"t\"\n[[settings.http.client]]\nid = \"ci\"\ntoken = \"t\"", `http: duplicate client id "ci"`},
+		{"listen = \":8080\"\n[[settings.http.client]]\nid = \"ci\"\ntoken = \"t\"\n[[settings.http.client]]\nid = \"cd\"\ntoken = \"t\"", `http client "cd": token is used by another client`},
+		{"listen = \":8080\"\n[[settings.http.client]]\nid = \"ci\"\ntoken = \"t\"\nallow = [\"[\"]", `http client "ci": bad allow pattern "["`},
+	}
+	for i, test := range tests {
+		_, err := Parse(testScheduleConfig + "\n[settings.http]\n" + test.http)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+		}
+	}
+}
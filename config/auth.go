@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+)
+
+// UnmarshalTOML decodes the auth from the profile id string or from the table with optional profile overrides
+func (a *auth) UnmarshalTOML(data interface{}) error {
+	switch data := data.(type) {
+	case string:
+		*a = auth{Profile: data}
+		return nil
+	case map[string]interface{}:
+		fields := map[string]*string{
+			"id":             &a.Id,
+			"profile":        &a.Profile,
+			"type":           &a.Type,
+			"username":       &a.Username,
+			"password":       &a.Password,
+			"passwordFile":   &a.PasswordFile,
+			"privateKeyPath": &a.PrivateKeyPath,
+			"passphrase":     &a.Passphrase,
+			"passphraseFile": &a.PassphraseFile,
+		}
+		for k, v := range data {
+			field, exist := fields[k]
+			if !exist {
+				return fmt.Errorf("unknown auth field %q", k)
+			}
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("auth field %q must be a string", k)
+			}
+			*field = s
+		}
+		return nil
+	}
+	return fmt.Errorf("auth must be a profile id or a table, got %T", data)
+}
+
+// withProfile returns the auth profile with fields overridden by the auth ones
+func (a auth) withProfile(profiles map[string]auth) (auth, error) {
+	if a.Profile == "" {
+		return a, nil
+	}
+	p, exist := profiles[a.Profile]
+	if !exist {
+		return a, fmt.Errorf("auth profile %q not found", a.Profile)
+	}
+	if a.Type != "" {
+		p.Type = a.Type
+	}
+	if a.Username != "" {
+		p.Username = a.Username
+	}
+	if a.Password != "" || a.PasswordFile != "" {
+		p.Password, p.PasswordFile = a.Password, a.PasswordFile
+	}
+	if a.PrivateKeyPath != "" {
+		p.PrivateKeyPath = a.PrivateKeyPath
+	}
+	if a.Passphrase != "" || a.PassphraseFile != "" {
+		p.Passphrase, p.PassphraseFile = a.Passphrase, a.PassphraseFile
+	}
+	p.Id, p.Profile = "", ""
+	return p, nil
+}
+
+// resolveAuthProfiles validates auth profiles and replaces hosts and discoveries profile references with them
+func resolveAuthProfiles(internal *config, secrets *SecretResolver) error {
+	profiles := make(map[string]auth)
+	for _, p := range internal.Auths {
+		if p.Id == "" {
+			return fmt.Errorf("auth profile with username %q has empty id", p.Username)
+		}
+		if _, exist := profiles[p.Id]; exist {
+			return fmt.Errorf("duplicate auth profile id %q", p.Id)
+		}
+		if p.Profile != "" {
+			return fmt.Errorf("auth profile %q: profiles can't reference other profiles", p.Id)
+		}
+		if _, err := buildAuth(p, secrets); err != nil {
+			return fmt.Errorf("auth profile %q: %v", p.Id, err)
+		}
+		profiles[p.Id] = p
+	}
+
+	for i := range internal.Hosts {
+		h := &internal.Hosts[i]
+		a, err := h.Auth.withProfile(profiles)
+		if err != nil {
+			return fmt.Errorf("host %q%s: %v", h.Id, in(h.source), err)
+		}
+		h.Auth = a
+	}
+	for i := range internal.Discoveries {
+		d := &internal.Discoveries[i]
+		a, err := d.Auth.withProfile(profiles)
+		if err != nil {
+			return fmt.Errorf("discovery %q: %v", d.Id, err)
+		}
+		d.Auth = a
+	}
+	return nil
+}
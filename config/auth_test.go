@@ -0,0 +1,87 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAuthProfiles(t *testing.T) {
+	conf, err := Parse(`
+[[auth]]
+    id = "ops-key"
+    type = "publickey"
+    username = "ops"
+    privateKeyPath = "/keys/ops"
+    passphrase = "ops-passphrase"
+
+[[host]]
+    id = "web1"
+    auth = "ops-key"
+
+[[host]]
+    id = "web2"
+    [host.auth]
+        profile = "ops-key"
+        username = "root"
+        passphrase = "root-passphrase"
+
+[[host]]
+    id = "web3"
+    [host.auth]
+        type = "password"
+        username = "shmee"
+        password = "gayjke"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]*Auth{
+		"web1": {Type: "publickey", Username: "ops", PrivateKeyPath: "/keys/ops", Passphrase: "ops-passphrase"},
+		"web2": {Type: "publickey", Username: "root", PrivateKeyPath: "/keys/ops", Passphrase: "root-passphrase"},
+		"web3": {Type: "password", Username: "shmee", Password: "gayjke"},
+	}
+	for id, auth := range expected {
+		if !reflect.DeepEqual(conf.Hosts[id].Auth, auth) {
+			t.Errorf("%s: Got auth: %+v, want: %+v", id, conf.Hosts[id].Auth, auth)
+		}
+	}
+}
+
+func TestParseAuthProfilesErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{
+			"[[host]]\n    id = \"web1\"\n    auth = \"none\"",
+			`host "web1": auth profile "none" not found`,
+		},
+		{
+			"[[auth]]\n    type = \"password\"\n    username = \"ops\"",
+			`auth profile with username "ops" has empty id`,
+		},
+		{
+			"[[auth]]\n    id = \"ops\"\n    type = \"password\"\n[[auth]]\n    id = \"ops\"\n    type = \"password\"",
+			`duplicate auth profile id "ops"`,
+		},
+		{
+			"[[auth]]\n    id = \"ops\"\n    type = \"token\"",
+			`auth profile "ops": bad auth type "token"`,
+		},
+		{
+			"[[auth]]\n    id = \"ops\"\n    type = \"password\"\n    profile = \"other\"",
+			`auth profile "ops": profiles can't reference other profiles`,
+		},
+		{
+			"[[host]]\n    id = \"web1\"\n    [host.auth]\n        type = \"password\"\n        port = \"22\"",
+			`unknown auth field "port"`,
+		},
+	}
+	for i, test := range tests {
+		_, err := Parse(test.config)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/karlovskiy/bb8bot/jsonpath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCheckInterval is the check execution interval
+const defaultCheckInterval = 5 * time.Minute
+
+// Check states
+const (
+	CheckOK      = "OK"
+	CheckWarn    = "WARN"
+	CheckCrit    = "CRIT"
+	CheckUnknown = "UNKNOWN"
+)
+
+// Check is the periodic group command execution with the numeric value extracted from the output
+// and compared with warn and crit thresholds
+type Check struct {
+	Id       string
+	Interval time.Duration
+	Group    string
+	Host     string
+	Command  string
+	Args     []string
+	Channel  string
+	Regex    *regexp.Regexp
+	JSONPath *jsonpath.Path
+	Warn     *float64
+	Crit     *float64
+	// Below means lower values are worse, like free space
+	Below bool
+	// Confirm is the number of consecutive results required to change the state
+	Confirm int
+}
+
+// Action returns the chat action text for the check: <group> [host] <command> [args]
+func (c *Check) Action() string {
+	return actionText(c.Group, c.Host, c.Command, c.Args)
+}
+
+// Evaluate extracts the value from the command output and returns its state
+func (c *Check) Evaluate(output string) (string, float64, error) {
+	value, err := c.extract(output)
+	if err != nil {
+		return CheckUnknown, 0, err
+	}
+	return c.State(value), value, nil
+}
+
+// State returns the state of the value by thresholds
+func (c *Check) State(value float64) string {
+	exceeds := func(threshold *float64) bool {
+		if threshold == nil {
+			return false
+		}
+		if c.Below {
+			return value <= *threshold
+		}
+		return value >= *threshold
+	}
+	if exceeds(c.Crit) {
+		return CheckCrit
+	}
+	if exceeds(c.Warn) {
+		return CheckWarn
+	}
+	return CheckOK
+}
+
+// extract returns the regex submatch, the JSON path value or the whole output as the number
+func (c *Check) extract(output string) (float64, error) {
+	text := strings.TrimSpace(output)
+	switch {
+	case c.Regex != nil:
+		m := c.Regex.FindStringSubmatch(output)
+		if m == nil {
+			return 0, fmt.Errorf("regex %q doesn't match the output", c.Regex)
+		}
+		text = m[0]
+		if len(m) > 1 {
+			text = m[1]
+		}
+	case c.JSONPath != nil:
+		var data interface{}
+		if err := json.Unmarshal([]byte(output), &data); err != nil {
+			return 0, fmt.Errorf("error parsing output json: %v", err)
+		}
+		v, err := c.JSONPath.Get(data)
+		if err != nil {
+			return 0, err
+		}
+		if f, ok := v.(float64); ok {
+			return f, nil
+		}
+		text = fmt.Sprint(v)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return 0, fmt.Errorf("value %q is not a number", text)
+	}
+	return value, nil
+}
+
+// threshold is the TOML number, integers are accepted as well as floats
+type threshold struct {
+	value *float64
+}
+
+// UnmarshalTOML decodes integer and float thresholds
+func (t *threshold) UnmarshalTOML(data interface{}) error {
+	var value float64
+	switch v := data.(type) {
+	case int64:
+		value = float64(v)
+	case float64:
+		value = v
+	default:
+		return fmt.Errorf("threshold %v is not a number", data)
+	}
+	t.value = &value
+	return nil
+}
+
+// buildChecks validates checks thresholds, extractors and group commands
+func buildChecks(internal *config, external *Config) ([]*Check, error) {
+	var checks []*Check
+	ids := make(map[string]struct{})
+	for _, c := range internal.Checks {
+		if c.Id == "" {
+			return nil, fmt.Errorf("check for command %q has empty id", c.Command)
+		}
+		if _, exist := ids[c.Id]; exist {
+			return nil, fmt.Errorf("duplicate check id %q", c.Id)
+		}
+		ids[c.Id] = struct{}{}
+
+		check := &Check{
+			Id:       c.Id,
+			Interval: defaultCheckInterval,
+			Group:    c.Group,
+			Host:     c.Host,
+			Command:  c.Command,
+			Args:     c.Args,
+			Channel:  c.Channel,
+			Warn:     c.Warn.value,
+			Crit:     c.Crit.value,
+			Below:    c.Below,
+			Confirm:  c.Confirm,
+		}
+		var err error
+		if c.Interval != "" {
+			check.Interval, err = time.ParseDuration(c.Interval)
+			if err != nil {
+				return nil, fmt.Errorf("check %q: %v", c.Id, err)
+			}
+		}
+		if check.Confirm <= 0 {
+			check.Confirm = 1
+		}
+		if c.Regex != "" && c.JSONPath != "" {
+			return nil, fmt.Errorf("check %q: only one of regex and jsonPath could be set", c.Id)
+		}
+		if c.Regex != "" {
+			check.Regex, err = regexp.Compile(c.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("check %q: bad regex: %v", c.Id, err)
+			}
+		}
+		if c.JSONPath != "" {
+			check.JSONPath, err = jsonpath.Parse(c.JSONPath)
+			if err != nil {
+				return nil, fmt.Errorf("check %q: %v", c.Id, err)
+			}
+		}
+		if check.Warn == nil && check.Crit == nil {
+			return nil, fmt.Errorf("check %q: warn or crit threshold is not set", c.Id)
+		}
+		if check.Warn != nil && check.Crit != nil && check.State(*check.Warn) == CheckCrit {
+			return nil, fmt.Errorf("check %q: warn threshold %v is beyond crit threshold %v", c.Id, *check.Warn, *check.Crit)
+		}
+		group, exist := external.Groups[c.Group]
+		if !exist {
+			return nil, fmt.Errorf("check %q: group %q not found", c.Id, c.Group)
+		}
+		if _, exist := group.Commands[c.Command]; !exist {
+			return nil, fmt.Errorf("check %q: command %q not found in group %q", c.Id, c.Command, c.Group)
+		}
+		if _, exist := group.Hosts[c.Host]; c.Host != "" && !strings.HasPrefix(c.Host, "@") && !exist {
+			return nil, fmt.Errorf("check %q: host %q not found in group %q", c.Id, c.Host, c.Group)
+		}
+		if c.Channel == "" {
+			return nil, fmt.Errorf("check %q: channel is not set", c.Id)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
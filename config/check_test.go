@@ -0,0 +1,124 @@
+package config
+
+import (
+	"github.com/karlovskiy/bb8bot/jsonpath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseChecks(t *testing.T) {
+	conf, err := Parse(testScheduleConfig + `
+[[check]]
+    id = "disk"
+    interval = "1m"
+    group = "unix"
+    command = "lsof"
+    args = ["ssh"]
+    regex = '(\d+)%'
+    warn = 80
+    crit = 90.5
+    confirm = 2
+    channel = "CRKR3KRN3"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Checks) != 1 {
+		t.Fatalf("Got checks: %v", conf.Checks)
+	}
+	c := conf.Checks[0]
+	if action := c.Action(); action != "unix lsof ssh" {
+		t.Errorf("Got action: %q", action)
+	}
+	if c.Interval != time.Minute || *c.Warn != 80 || *c.Crit != 90.5 || c.Confirm != 2 {
+		t.Errorf("Got check: %+v", c)
+	}
+
+	tests := []struct {
+		check string
+		err   string
+	}{
+		{
+			"id = \"c\"\ngroup = \"unix\"\ncommand = \"lsof\"\nchannel = \"C\"",
+			`check "c": warn or crit threshold is not set`,
+		},
+		{
+			"id = \"c\"\ngroup = \"unix\"\ncommand = \"lsof\"\nwarn = 90\ncrit = 80\nchannel = \"C\"",
+			`check "c": warn threshold 90 is beyond crit threshold 80`,
+		},
+		{
+			"id = \"c\"\ngroup = \"unix\"\ncommand = \"lsof\"\nwarn = \"high\"\nchannel = \"C\"",
+			`threshold high is not a number`,
+		},
+		{
+			"id = \"c\"\ngroup = \"unix\"\ncommand = \"lsof\"\nregex = \"(\"\nwarn = 1\nchannel = \"C\"",
+			"check \"c\": bad regex: error parsing regexp: missing closing ): `(`",
+		},
+		{
+			"id = \"c\"\ngroup = \"unix\"\ncommand = \"lsof\"\nregex = \"x\"\njsonPath = \"x\"\nwarn = 1\nchannel = \"C\"",
+			`check "c": only one of regex and jsonPath could be set`,
+		},
+		{
+			"id = \"c\"\ngroup = \"unix\"\ncommand = \"none\"\nwarn = 1\nchannel = \"C\"",
+			`check "c": command "none" not found in group "unix"`,
+		},
+		{
+			"id = \"c\"\ngroup = \"unix\"\ncommand = \"lsof\"\nwarn = 1",
+			`check "c": channel is not set`,
+		},
+	}
+	for i, test := range tests {
+		_, err := Parse(testScheduleConfig + "\n[[check]]\n" + test.check)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+		}
+	}
+}
+
+func TestCheckEvaluate(t *testing.T) {
+	warn, crit := 80.0, 90.0
+	low, lower := 20.0, 10.0
+	tests := []struct {
+		check  *Check
+		output string
+		state  string
+		value  float64
+		err    string
+	}{
+		{&Check{Warn: &warn, Crit: &crit}, " 42\n", CheckOK, 42, ""},
+		{&Check{Warn: &warn, Crit: &crit}, "80", CheckWarn, 80, ""},
+		{&Check{Warn: &warn}, "95", CheckWarn, 95, ""},
+		{&Check{Warn: &low, Crit: &lower, Below: true}, "15", CheckWarn, 15, ""},
+		{&Check{Warn: &low, Crit: &lower, Below: true}, "5", CheckCrit, 5, ""},
+		{&Check{Crit: &crit, Regex: mustRegexp(`/dev/sda1\s+\S+\s+(\d+)%`)}, "/dev/sda1  10G  93%", CheckCrit, 93, ""},
+		{&Check{Crit: &crit, Regex: mustRegexp(`\d+`)}, "load 7", CheckOK, 7, ""},
+		{&Check{Crit: &crit, Regex: mustRegexp(`(\d+)%`)}, "none", CheckUnknown, 0, "regex \"(\\\\d+)%\" doesn't match the output"},
+		{&Check{Crit: &crit, JSONPath: mustJSONPath("disk.usage")}, `{"disk":{"usage":91}}`, CheckCrit, 91, ""},
+		{&Check{Crit: &crit, JSONPath: mustJSONPath("disk.usage")}, `{"disk":{"usage":"12.5"}}`, CheckOK, 12.5, ""},
+		{&Check{Crit: &crit, JSONPath: mustJSONPath("disk.usage")}, `not json`, CheckUnknown, 0, "error parsing output json: invalid character 'o' in literal null (expecting 'u')"},
+		{&Check{Crit: &crit}, "n/a", CheckUnknown, 0, `value "n/a" is not a number`},
+	}
+	for i, test := range tests {
+		state, value, err := test.check.Evaluate(test.output)
+		var e string
+		if err != nil {
+			e = err.Error()
+		}
+		if state != test.state || value != test.value || e != test.err {
+			t.Errorf("%d: Got: %s %v %q, want: %s %v %q", i, state, value, e, test.state, test.value, test.err)
+		}
+	}
+}
+
+func mustRegexp(expr string) *regexp.Regexp {
+	return regexp.MustCompile(expr)
+}
+
+func mustJSONPath(expr string) *jsonpath.Path {
+	p, err := jsonpath.Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
@@ -3,19 +3,28 @@ package config
 import (
 	"fmt"
 	"github.com/BurntSushi/toml"
-	"io/ioutil"
+	"regexp"
 	"strings"
+	"text/template"
 	"time"
 )
 
 // ParseFile reads the file named by filename and returns the parsed config.
+// Files from the include directive are merged into the config.
+// If configPath is a directory, all *.toml files from it are merged.
 // A successful call returns err == nil.
 func ParseFile(configPath string) (*Config, error) {
-	c, err := ioutil.ReadFile(configPath)
+	internal, files, includes, err := loadFiles(configPath)
 	if err != nil {
 		return nil, err
 	}
-	return Parse(string(c))
+	c, err := build(internal)
+	if err != nil {
+		return nil, err
+	}
+	c.Files = files
+	c.Includes = includes
+	return c, nil
 }
 
 // Parse reads the config text and returns the parsed config.
@@ -25,6 +34,11 @@ func Parse(configData string) (*Config, error) {
 	if _, err := toml.Decode(configData, &internal); err != nil {
 		return nil, err
 	}
+	return build(&internal)
+}
+
+// build converts the decoded config into the external one
+func build(internal *config) (*Config, error) {
 	var help strings.Builder
 
 	defaultTimeout, err := time.ParseDuration("30s")
@@ -41,11 +55,39 @@ func Parse(configData string) (*Config, error) {
 	defaultMaxSymbolsPerMessage := internal.Settings.MaxSymbolsPerMessage
 	defaultMaxMessages := internal.Settings.MaxMessages
 
+	token, err := resolveSecret("token", internal.Settings.Token, internal.Settings.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := newVaultResolver(internal.Settings.Vault)
+	if err != nil {
+		return nil, err
+	}
+
+	httpSettings, err := buildHTTP(internal.Settings.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	historySettings, err := buildHistory(internal.Settings.History)
+	if err != nil {
+		return nil, err
+	}
+	globalRedactions, err := buildRedactions(internal.Settings.Redact)
+	if err != nil {
+		return nil, fmt.Errorf("settings: %v", err)
+	}
+
 	var external Config
 	external.Settings = &Settings{
-		Token:               internal.Settings.Token,
+		Token:               token,
 		ArgumentsTrimCutSet: internal.Settings.ArgumentsTrimCutSet,
+		CommandPrefixes:     internal.Settings.CommandPrefixes,
+		HTTP:                httpSettings,
+		History:             historySettings,
+		Redactions:          globalRedactions,
 	}
+	external.secrets = secrets
 
 	external.Settings.Channels = make(map[string]struct{})
 	for _, channel := range internal.Settings.Channels {
@@ -62,29 +104,72 @@ func Parse(configData string) (*Config, error) {
 		external.Settings.Admins[admin] = struct{}{}
 	}
 
+	if err := resolveAuthProfiles(internal, secrets); err != nil {
+		return nil, err
+	}
+	sshConf, err := importSSHConfig(internal)
+	if err != nil {
+		return nil, err
+	}
+	if err := importInventory(internal); err != nil {
+		return nil, err
+	}
+
 	external.Hosts = make(map[string]*Host)
 	for _, h := range internal.Hosts {
-		auth := h.Auth
+		if h.Id == "" {
+			return nil, fmt.Errorf("host with address %q%s has empty id", h.Address, in(h.source))
+		}
+		if _, exist := external.Hosts[h.Id]; exist {
+			return nil, fmt.Errorf("duplicate host id %q", h.Id)
+		}
+		hostAuth, err := buildAuth(h.Auth, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("host %q%s: %v", h.Id, in(h.source), err)
+		}
+		var jump *Host
+		if h.proxyJump != "" {
+			jump, err = sshConf.jumpHost(h.proxyJump, hostAuth)
+			if err != nil {
+				return nil, fmt.Errorf("host %q%s: %v", h.Id, in(h.source), err)
+			}
+		}
 		external.Hosts[h.Id] = &Host{
 			Id:      h.Id,
 			Address: h.Address,
 			Port:    h.Port,
-			Auth: &Auth{
-				Type:           auth.Type,
-				Username:       auth.Username,
-				Password:       auth.Password,
-				PrivateKeyPath: auth.PrivateKeyPath,
-				Passphrase:     auth.Passphrase,
-			},
+			Tags:    h.Tags,
+			Vars:    h.Vars,
+			Auth:    hostAuth,
+			Jump:    jump,
 		}
 	}
+	if err := external.Settings.HTTP.validateReadyHosts(external.Hosts); err != nil {
+		return nil, err
+	}
+
+	if err := validateGroupAliases(internal); err != nil {
+		return nil, err
+	}
 
 	help.WriteString(fmt.Sprintf("%s_*Groups:*_\n", internal.Settings.Description))
 	external.Groups = make(map[string]*Group)
 	for _, g := range internal.Groups {
-		help.WriteString(fmt.Sprintf("\n`%s`   _%s_", g.Id, g.Description))
+		if g.Id == "" {
+			return nil, fmt.Errorf("group with description %q%s has empty id", g.Description, in(g.source))
+		}
+		if _, exist := external.Groups[g.Id]; exist {
+			return nil, fmt.Errorf("duplicate group id %q", g.Id)
+		}
+		// bot commands are handled before groups, so such groups couldn't be used
+		if isReserved(g.Id) {
+			return nil, fmt.Errorf("group %q%s: id is reserved for the bot command", g.Id, in(g.source))
+		}
+		help.WriteString(fmt.Sprintf("\n`%s`%s   _%s_", g.Id, aliasHelp(g.Aliases), g.Description))
 		group := &Group{
-			Id: g.Id,
+			Id:      g.Id,
+			Vars:    g.Vars,
+			Aliases: g.Aliases,
 		}
 		external.Groups[group.Id] = group
 		var groupHelp strings.Builder
@@ -92,9 +177,37 @@ func Parse(configData string) (*Config, error) {
 		groupHelp.WriteString(fmt.Sprintf("%s\n_*Hosts:*_", internal.Settings.Description))
 		group.Hosts = make(map[string]*Host)
 		for _, gh := range g.Hosts {
-			group.Hosts[gh] = external.Hosts[gh]
+			h, exist := external.Hosts[gh]
+			if !exist {
+				return nil, fmt.Errorf("group %q%s: host %q not found", g.Id, in(g.source), gh)
+			}
+			group.Hosts[gh] = h
 			groupHelp.WriteString(fmt.Sprintf(" `%s`", gh))
 		}
+		for _, name := range g.InventoryGroups {
+			ids, exist := internal.inventoryGroups[name]
+			if !exist {
+				return nil, fmt.Errorf("group %q%s: inventory group %q not found", g.Id, in(g.source), name)
+			}
+			for _, id := range ids {
+				if _, exist := group.Hosts[id]; !exist {
+					group.Hosts[id] = external.Hosts[id]
+					groupHelp.WriteString(fmt.Sprintf(" `%s`", id))
+				}
+			}
+		}
+		if g.Tags != "" {
+			selector, err := ParseSelector(g.Tags)
+			if err != nil {
+				return nil, fmt.Errorf("group %q%s: %v", g.Id, in(g.source), err)
+			}
+			for _, h := range selector.Select(external.Hosts) {
+				if _, exist := group.Hosts[h.Id]; !exist {
+					group.Hosts[h.Id] = h
+					groupHelp.WriteString(fmt.Sprintf(" `%s`", h.Id))
+				}
+			}
+		}
 
 		groupArgs := make(map[string]*Argument)
 		for _, a := range g.Arguments {
@@ -115,22 +228,38 @@ func Parse(configData string) (*Config, error) {
 			}
 		}
 
-		groupHelp.WriteString("\n_*Commands:*_")
+		groupHelp.WriteString(commandsHelpHeader)
 		group.Commands = make(map[string]*Command)
 		for _, c := range g.Commands {
-			groupHelp.WriteString(fmt.Sprintf("\n`%s`   _%s_", c.Id, c.Description))
+			if _, exist := group.Commands[c.Id]; exist {
+				return nil, fmt.Errorf("group %q%s: duplicate command id %q", g.Id, in(g.source), c.Id)
+			}
+			groupHelp.WriteString(fmt.Sprintf("\n`%s`%s   _%s_", c.Id, aliasHelp(c.Aliases), c.Description))
 
 			var commandHelp strings.Builder
 			var argsHelp strings.Builder
 			commandHelp.WriteString(fmt.Sprintf("_%s_\n_*Format:*_\n```%s [host] %s", c.Description, group.Id, c.Id))
 			args := make([]*Argument, len(c.Arguments))
 			for i, a := range c.Arguments {
-				args[i] = groupArgs[a]
+				arg, exist := groupArgs[a]
+				if !exist {
+					return nil, fmt.Errorf("group %q%s: command %q: argument %q not found", g.Id, in(g.source), c.Id, a)
+				}
+				args[i] = arg
 				commandHelp.WriteString(fmt.Sprintf(" <%s>", args[i].Id))
 				argsHelp.WriteString(fmt.Sprintf("\n%s", args[i].Help))
 			}
 			commandHelp.WriteString(fmt.Sprintf("```%s", argsHelp.String()))
 
+			var selector *Selector
+			if c.Tags != "" {
+				selector, err = ParseSelector(c.Tags)
+				if err != nil {
+					return nil, fmt.Errorf("group %q%s: command %q: %v", g.Id, in(g.source), c.Id, err)
+				}
+				commandHelp.WriteString(fmt.Sprintf("\n_*Hosts tags:*_ `%s`", c.Tags))
+			}
+
 			timeout := defaultTimeout
 			if c.Timeout != "" {
 				timeout, err = time.ParseDuration(c.Timeout)
@@ -147,6 +276,28 @@ func Parse(configData string) (*Config, error) {
 			if c.MaxMessages != 0 {
 				maxMessages = c.MaxMessages
 			}
+			codeBlock := internal.Settings.CodeBlock
+			if c.CodeBlock != nil {
+				codeBlock = *c.CodeBlock
+			}
+
+			redactions, err := buildRedactions(c.Redact)
+			if err != nil {
+				return nil, fmt.Errorf("group %q%s: command %q: %v", g.Id, in(g.source), c.Id, err)
+			}
+
+			output, err := buildOutput(c)
+			if err != nil {
+				return nil, fmt.Errorf("group %q%s: command %q: %v", g.Id, in(g.source), c.Id, err)
+			}
+
+			var tmpl *template.Template
+			if strings.Contains(c.Format, "{{") {
+				tmpl, err = template.New(c.Id).Option("missingkey=error").Parse(c.Format)
+				if err != nil {
+					return nil, fmt.Errorf("group %q%s: command %q: %v", g.Id, in(g.source), c.Id, err)
+				}
+			}
 
 			group.Commands[c.Id] = &Command{
 				Id:                   c.Id,
@@ -155,21 +306,90 @@ func Parse(configData string) (*Config, error) {
 				Arguments:            args,
 				MaxSymbolsPerMessage: maxSymbolsPerMessage,
 				MaxMessages:          maxMessages,
+				CodeBlock:            codeBlock,
 				Timeout:              timeout,
+				Selector:             selector,
+				Aliases:              c.Aliases,
+				Redactions:           redactions,
+				Output:               output,
+				template:             tmpl,
 			}
 		}
 		group.Help = groupHelp.String()
 	}
+	external.Aliases, err = buildAliases(internal, &external)
+	if err != nil {
+		return nil, err
+	}
+	if len(internal.Aliases) > 0 {
+		help.WriteString("\n_*Aliases:*_")
+		for _, a := range internal.Aliases {
+			help.WriteString(fmt.Sprintf("\n`%s`   `%s`", a.Name, external.Aliases[a.Name]))
+		}
+	}
 	external.Help = help.String()
+
+	external.Discoveries, err = buildDiscoveries(internal, external.Groups, secrets)
+	if err != nil {
+		return nil, err
+	}
+	external.Schedules, err = buildSchedules(internal, &external)
+	if err != nil {
+		return nil, err
+	}
+	external.Checks, err = buildChecks(internal, &external)
+	if err != nil {
+		return nil, err
+	}
 	return &external, nil
 }
 
+// buildAuth resolves auth secrets and validates it
+func buildAuth(a auth, secrets *SecretResolver) (*Auth, error) {
+	if a.Type != "password" && a.Type != "publickey" {
+		return nil, fmt.Errorf("bad auth type %q", a.Type)
+	}
+	password, err := resolveSecret("password", a.Password, a.PasswordFile)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := resolveSecret("passphrase", a.Passphrase, a.PassphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := secrets.validateReference("password", password); err != nil {
+		return nil, err
+	}
+	if err := secrets.validateReference("passphrase", passphrase); err != nil {
+		return nil, err
+	}
+	result := &Auth{
+		Type:           a.Type,
+		Username:       a.Username,
+		Password:       password,
+		PrivateKeyPath: a.PrivateKeyPath,
+		Passphrase:     passphrase,
+	}
+	if secrets.IsReference(password) || secrets.IsReference(passphrase) {
+		result.secrets = secrets
+	}
+	return result, nil
+}
+
 // Config is the main config type
 type Config struct {
-	Settings *Settings
-	Hosts    map[string]*Host
-	Groups   map[string]*Group
-	Help     string
+	Settings    *Settings
+	Hosts       map[string]*Host
+	Groups      map[string]*Group
+	Discoveries []*Discovery
+	Schedules   []*Schedule
+	Checks      []*Check
+	Aliases     map[string]string
+	Help        string
+	Files       []string
+	Includes    []string
+
+	secrets *SecretResolver
 }
 
 // Settings is the config's part with slack token, users, channels and etc.
@@ -179,22 +399,45 @@ type Settings struct {
 	Users               map[string]struct{}
 	Admins              map[string]struct{}
 	ArgumentsTrimCutSet string
+	CommandPrefixes     bool
+	HTTP                *HTTP
+	History             *History
+	Redactions          []*regexp.Regexp
 }
 
-// Group is the group with commands
+// Group is the group with commands.
+// Vars are the default command variables for the group hosts.
 type Group struct {
 	Id       string
 	Help     string
 	Hosts    map[string]*Host
 	Commands map[string]*Command
+	Vars     map[string]string
+	Aliases  []string
+}
+
+// HostVars returns the group variables overridden by the host ones
+func (g *Group) HostVars(h *Host) map[string]string {
+	vars := make(map[string]string, len(g.Vars)+len(h.Vars))
+	for k, v := range g.Vars {
+		vars[k] = v
+	}
+	for k, v := range h.Vars {
+		vars[k] = v
+	}
+	return vars
 }
 
 // Host is the host address, port, authentication and etc.
+// Jump is the host to connect through (ProxyJump).
 type Host struct {
 	Id      string
 	Address string
 	Port    int
+	Tags    []string
+	Vars    map[string]string
 	Auth    *Auth
+	Jump    *Host
 }
 
 // Auth is the authentication information
@@ -204,9 +447,33 @@ type Auth struct {
 	Password       string
 	PrivateKeyPath string
 	Passphrase     string
+	secrets        *SecretResolver
+}
+
+// ResolvePassword returns the password, reading it from the secret provider if it is a secret reference
+func (a *Auth) ResolvePassword() (string, error) {
+	return a.secrets.Resolve(a.Password)
+}
+
+// ResolvePassphrase returns the passphrase, reading it from the secret provider if it is a secret reference
+func (a *Auth) ResolvePassphrase() (string, error) {
+	return a.secrets.Resolve(a.Passphrase)
 }
 
-// Command is the command attributes and arguments
+// RefreshSecrets drops the cached secrets, so rotated ones will be read on next resolve.
+// It reports whether the auth has any secret references.
+func (a *Auth) RefreshSecrets() bool {
+	if a.secrets == nil {
+		return false
+	}
+	a.secrets.Refresh(a.Password)
+	a.secrets.Refresh(a.Passphrase)
+	return true
+}
+
+// Command is the command attributes and arguments.
+// Selector restricts hosts the command can be executed on, nil means all group hosts.
+// CodeBlock wraps every output message in the code block.
 type Command struct {
 	Id                   string
 	Help                 string
@@ -215,6 +482,41 @@ type Command struct {
 	Timeout              time.Duration
 	MaxSymbolsPerMessage int
 	MaxMessages          int
+	CodeBlock            bool
+	Selector             *Selector
+	Aliases              []string
+	Redactions           []*regexp.Regexp
+	Output               *Output
+	template             *template.Template
+}
+
+// Render returns the command text with the host variables ({{.name}}) and the arguments values (%s)
+func (c *Command) Render(vars map[string]string, args []interface{}) (string, error) {
+	format := c.Format
+	if c.template != nil {
+		data := vars
+		if len(args) > 0 {
+			// the rendered template is the arguments format, so percent signs of variables are escaped
+			data = make(map[string]string, len(vars))
+			for k, v := range vars {
+				data[k] = strings.Replace(v, "%", "%%", -1)
+			}
+		}
+		var b strings.Builder
+		if err := c.template.Execute(&b, data); err != nil {
+			return "", err
+		}
+		format = b.String()
+	}
+	if len(args) == 0 {
+		return format, nil
+	}
+	return fmt.Sprintf(format, args...), nil
+}
+
+// Allowed reports whether the command can be executed on the host
+func (c *Command) Allowed(h *Host) bool {
+	return c.Selector == nil || c.Selector.Match(h)
 }
 
 // Argument is the command argument
@@ -231,29 +533,60 @@ type Item struct {
 }
 
 type config struct {
-	Settings settings `toml:"settings"`
-	Hosts    []host   `toml:"host"`
-	Groups   []group  `toml:"group"`
+	Include     []string    `toml:"include"`
+	Settings    settings    `toml:"settings"`
+	Hosts       []host      `toml:"host"`
+	Groups      []group     `toml:"group"`
+	Discoveries []discovery `toml:"discovery"`
+	Auths       []auth      `toml:"auth"`
+	Schedules   []schedule  `toml:"schedule"`
+	Checks      []check     `toml:"check"`
+	Aliases     []alias     `toml:"alias"`
+
+	inventoryGroups map[string][]string
 }
 
 type settings struct {
-	Token                string   `toml:"token"`
-	Description          string   `toml:"description"`
-	MaxSymbolsPerMessage int      `toml:"maxSymbolsPerMessage"`
-	MaxMessages          int      `toml:"maxMessages"`
-	Timeout              string   `toml:"timeout"`
-	Channels             []string `toml:"channels"`
-	Users                []string `toml:"users"`
-	Admins               []string `toml:"admins"`
-	ArgumentsTrimCutSet  string   `toml:"argumentsTrimCutSet"`
+	Token                string       `toml:"token"`
+	TokenFile            string       `toml:"tokenFile"`
+	Description          string       `toml:"description"`
+	MaxSymbolsPerMessage int          `toml:"maxSymbolsPerMessage"`
+	MaxMessages          int          `toml:"maxMessages"`
+	CodeBlock            bool         `toml:"codeBlock"`
+	Timeout              string       `toml:"timeout"`
+	Channels             []string     `toml:"channels"`
+	Users                []string     `toml:"users"`
+	Admins               []string     `toml:"admins"`
+	ArgumentsTrimCutSet  string       `toml:"argumentsTrimCutSet"`
+	CommandPrefixes      bool         `toml:"commandPrefixes"`
+	Vault                vault        `toml:"vault"`
+	SSHConfig            string       `toml:"sshConfig"`
+	ImportSSHConfig      bool         `toml:"importSshConfig"`
+	Inventory            string       `toml:"inventory"`
+	HTTP                 httpSettings `toml:"http"`
+	History              history      `toml:"history"`
+	Redact               []string     `toml:"redact"`
+}
+
+type vault struct {
+	Address   string `toml:"address"`
+	Token     string `toml:"token"`
+	TokenFile string `toml:"tokenFile"`
+	Namespace string `toml:"namespace"`
+	TTL       string `toml:"ttl"`
 }
 
 type group struct {
-	Id          string     `toml:"id"`
-	Description string     `toml:"description"`
-	Hosts       []string   `toml:"hosts"`
-	Commands    []command  `toml:"command"`
-	Arguments   []argument `toml:"argument"`
+	Id              string            `toml:"id"`
+	Description     string            `toml:"description"`
+	Hosts           []string          `toml:"hosts"`
+	Tags            string            `toml:"tags"`
+	Vars            map[string]string `toml:"vars"`
+	Commands        []command         `toml:"command"`
+	Arguments       []argument        `toml:"argument"`
+	Aliases         []string          `toml:"aliases"`
+	InventoryGroups []string          `toml:"inventoryGroups"`
+	source          string
 }
 
 type command struct {
@@ -264,21 +597,103 @@ type command struct {
 	MaxSymbolsPerMessage int      `toml:"maxSymbolsPerMessage"`
 	MaxMessages          int      `toml:"maxMessages"`
 	Timeout              string   `toml:"timeout"`
+	Tags                 string   `toml:"tags"`
+	CodeBlock            *bool    `toml:"codeBlock"`
+	Aliases              []string `toml:"aliases"`
+	Redact               []string `toml:"redact"`
+	Output               string   `toml:"output"`
+	JSONPath             string   `toml:"jsonPath"`
+	Columns              []string `toml:"columns"`
 }
 
 type host struct {
-	Id      string `toml:"id"`
-	Address string `toml:"address"`
-	Port    int    `toml:"port"`
-	Auth    auth   `toml:"auth"`
+	Id            string            `toml:"id"`
+	Address       string            `toml:"address"`
+	Port          int               `toml:"port"`
+	SSHConfigHost string            `toml:"sshConfigHost"`
+	Tags          []string          `toml:"tags"`
+	Vars          map[string]string `toml:"vars"`
+	Auth          auth              `toml:"auth"`
+	source        string
+	proxyJump     string
 }
 
 type auth struct {
+	Id             string `toml:"id"`
+	Profile        string `toml:"profile"`
 	Type           string `toml:"type"`
 	Username       string `toml:"username"`
 	Password       string `toml:"password"`
+	PasswordFile   string `toml:"passwordFile"`
 	PrivateKeyPath string `toml:"privateKeyPath"`
 	Passphrase     string `toml:"passphrase"`
+	PassphraseFile string `toml:"passphraseFile"`
+}
+
+type discovery struct {
+	Id       string   `toml:"id"`
+	Type     string   `toml:"type"`
+	Service  string   `toml:"service"`
+	Address  string   `toml:"address"`
+	Tag      string   `toml:"tag"`
+	Port     int      `toml:"port"`
+	Interval string   `toml:"interval"`
+	Group    string   `toml:"group"`
+	Tags     []string `toml:"tags"`
+	Auth     auth     `toml:"auth"`
+}
+
+type history struct {
+	Path  string `toml:"path"`
+	Limit int    `toml:"limit"`
+}
+
+type httpSettings struct {
+	Listen            string      `toml:"listen"`
+	Clients           []apiClient `toml:"client"`
+	ReadyHosts        []string    `toml:"readyHosts"`
+	SigningSecret     string      `toml:"signingSecret"`
+	SigningSecretFile string      `toml:"signingSecretFile"`
+}
+
+type apiClient struct {
+	Id        string   `toml:"id"`
+	Token     string   `toml:"token"`
+	TokenFile string   `toml:"tokenFile"`
+	Allow     []string `toml:"allow"`
+	Channel   string   `toml:"channel"`
+}
+
+type schedule struct {
+	Id       string   `toml:"id"`
+	Cron     string   `toml:"cron"`
+	Timezone string   `toml:"timezone"`
+	Group    string   `toml:"group"`
+	Host     string   `toml:"host"`
+	Command  string   `toml:"command"`
+	Args     []string `toml:"args"`
+	Channel  string   `toml:"channel"`
+}
+
+type check struct {
+	Id       string    `toml:"id"`
+	Interval string    `toml:"interval"`
+	Group    string    `toml:"group"`
+	Host     string    `toml:"host"`
+	Command  string    `toml:"command"`
+	Args     []string  `toml:"args"`
+	Channel  string    `toml:"channel"`
+	Regex    string    `toml:"regex"`
+	JSONPath string    `toml:"jsonPath"`
+	Warn     threshold `toml:"warn"`
+	Crit     threshold `toml:"crit"`
+	Below    bool      `toml:"below"`
+	Confirm  int       `toml:"confirm"`
+}
+
+type alias struct {
+	Name string `toml:"name"`
+	Run  string `toml:"run"`
 }
 
 type argument struct {
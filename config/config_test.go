@@ -238,3 +238,194 @@ func TestParse(t *testing.T) {
 			expected, actual)
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{
+			`[[host]]
+    address = "onehost"
+    [host.auth]
+        type = "password"`,
+			`host with address "onehost" has empty id`,
+		},
+		{
+			`[[host]]
+    id = "onehost"
+    [host.auth]
+        type = "password"
+[[host]]
+    id = "onehost"
+    [host.auth]
+        type = "password"`,
+			`duplicate host id "onehost"`,
+		},
+		{
+			`[[host]]
+    id = "onehost"
+    [host.auth]
+        type = "token"`,
+			`host "onehost": bad auth type "token"`,
+		},
+		{
+			`[[group]]
+    id = "group1"
+    hosts = ["onehost"]`,
+			`group "group1": host "onehost" not found`,
+		},
+		{
+			`[[group]]
+    id = "group1"
+[[group]]
+    id = "group1"`,
+			`duplicate group id "group1"`,
+		},
+		{
+			`[[group]]
+    id = "schedules"`,
+			`group "schedules": id is reserved for the bot command`,
+		},
+		{
+			`[[group]]
+    id = "schedule"`,
+			`group "schedule": id is reserved for the bot command`,
+		},
+		{
+			`[[group]]
+    id = "checks"`,
+			`group "checks": id is reserved for the bot command`,
+		},
+		{
+			`[[group]]
+    id = "history"`,
+			`group "history": id is reserved for the bot command`,
+		},
+		{
+			`[[group]]
+    id = "show"`,
+			`group "show": id is reserved for the bot command`,
+		},
+		{
+			`[[group]]
+    id = "rerun"`,
+			`group "rerun": id is reserved for the bot command`,
+		},
+		{
+			`[[group]]
+    id = "diff"`,
+			`group "diff": id is reserved for the bot command`,
+		},
+		{
+			`[[group]]
+    id = "!!"`,
+			`group "!!": id is reserved for the bot command`,
+		},
+		{
+			`[[group]]
+    id = "group1"
+    [[group.command]]
+        id = "cmd"
+    [[group.command]]
+        id = "cmd"`,
+			`group "group1": duplicate command id "cmd"`,
+		},
+		{
+			`[[group]]
+    id = "group1"
+    [[group.command]]
+        id = "cmd"
+        cmdFmt = "cmd %s"
+        arguments = ["argument"]`,
+			`group "group1": command "cmd": argument "argument" not found`,
+		},
+	}
+
+	for i, test := range tests {
+		_, err := Parse(test.config)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+		}
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	conf, err := Parse(`
+[[group]]
+    id = "app"
+    hosts = ["onehost", "anotherhost"]
+    [group.vars]
+        service = "app"
+        logDir = "/var/log/app"
+        date = "+%Y-%m-%d"
+
+    [[group.command]]
+        id = "logs"
+        cmdFmt = "tail -n %s {{.logDir}}/{{.service}}.log"
+        arguments = ["lines"]
+
+    [[group.command]]
+        id = "status"
+        cmdFmt = "systemctl status {{.unit}}"
+
+    [[group.command]]
+        id = "journal"
+        cmdFmt = "journalctl -n %s --since $(date {{.date}})"
+        arguments = ["lines"]
+
+    [[group.command]]
+        id = "date"
+        cmdFmt = "date {{.date}}"
+
+    [[group.argument]]
+        id = "lines"
+        [[group.argument.item]]
+            name = "short"
+            value = "10"
+
+[[host]]
+    id = "onehost"
+    [host.vars]
+        logDir = "/data/logs"
+    [host.auth]
+        type = "password"
+
+[[host]]
+    id = "anotherhost"
+    [host.auth]
+        type = "password"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := conf.Groups["app"]
+
+	tests := []struct {
+		host    string
+		command string
+		args    []interface{}
+		cmd     string
+		err     bool
+	}{
+		{"onehost", "logs", []interface{}{"10"}, "tail -n 10 /data/logs/app.log", false},
+		{"anotherhost", "logs", []interface{}{"10"}, "tail -n 10 /var/log/app/app.log", false},
+		{"onehost", "status", nil, "", true},
+		{"onehost", "journal", []interface{}{"10"}, "journalctl -n 10 --since $(date +%Y-%m-%d)", false},
+		{"onehost", "date", nil, "date +%Y-%m-%d", false},
+	}
+	for i, test := range tests {
+		cmd, err := group.Commands[test.command].Render(group.HostVars(conf.Hosts[test.host]), test.args)
+		if (err != nil) != test.err {
+			t.Errorf("%d: Got err: %v", i, err)
+		}
+		if cmd != test.cmd {
+			t.Errorf("%d: Got cmd: %q, want: %q", i, cmd, test.cmd)
+		}
+	}
+
+	if _, err := Parse("[[group]]\n    id = \"app\"\n    [[group.command]]\n        id = \"bad\"\n        cmdFmt = \"{{.unclosed\""); err == nil {
+		t.Error("Got no error for bad command template")
+	}
+}
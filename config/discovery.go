@@ -0,0 +1,265 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultDiscoveryInterval is the hosts discovery refresh interval
+const defaultDiscoveryInterval = time.Minute
+
+// Discovery is the dynamic hosts source attached to the group.
+// Discovered hosts share the discovery auth and tags.
+type Discovery struct {
+	Id       string
+	Type     string
+	Service  string
+	Address  string
+	Tag      string
+	Port     int
+	Interval time.Duration
+	Group    string
+	Tags     []string
+	Auth     *Auth
+	Provider HostProvider
+}
+
+// HostProvider discovers hosts
+type HostProvider interface {
+	// Hosts returns the currently available hosts addresses and ports
+	Hosts() ([]*Host, error)
+}
+
+// SRVProvider discovers hosts by DNS SRV records
+type SRVProvider struct {
+	Name     string
+	resolver func(service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Hosts resolves SRV records to hosts with target names as ids
+func (p *SRVProvider) Hosts() ([]*Host, error) {
+	lookup := p.resolver
+	if lookup == nil {
+		lookup = net.LookupSRV
+	}
+	_, records, err := lookup("", "", p.Name)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]*Host, 0, len(records))
+	for _, r := range records {
+		target := strings.TrimSuffix(r.Target, ".")
+		hosts = append(hosts, &Host{
+			Id:      target,
+			Address: target,
+			Port:    int(r.Port),
+		})
+	}
+	return hosts, nil
+}
+
+// ConsulProvider discovers hosts by the service from the Consul compatible HTTP catalog
+type ConsulProvider struct {
+	Address string
+	Service string
+	Tag     string
+	Client  *http.Client
+}
+
+// Hosts returns the service nodes with node names as ids and service tags as host tags
+func (p *ConsulProvider) Hosts() ([]*Host, error) {
+	u := strings.TrimRight(p.Address, "/") + "/v1/catalog/service/" + url.PathEscape(p.Service)
+	if p.Tag != "" {
+		u += "?tag=" + url.QueryEscape(p.Tag)
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("catalog responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var services []struct {
+		Node           string
+		Address        string
+		ServiceAddress string
+		ServicePort    int
+		ServiceTags    []string
+	}
+	if err := json.Unmarshal(body, &services); err != nil {
+		return nil, fmt.Errorf("error parsing catalog response: %v", err)
+	}
+	hosts := make([]*Host, 0, len(services))
+	for _, s := range services {
+		address := s.ServiceAddress
+		if address == "" {
+			address = s.Address
+		}
+		hosts = append(hosts, &Host{
+			Id:      s.Node,
+			Address: address,
+			Port:    s.ServicePort,
+			Tags:    s.ServiceTags,
+		})
+	}
+	return hosts, nil
+}
+
+// Discover returns hosts from the provider with the discovery auth, tags and port
+func (d *Discovery) Discover() ([]*Host, error) {
+	hosts, err := d.Provider.Hosts()
+	if err != nil {
+		return nil, fmt.Errorf("discovery %q: %v", d.Id, err)
+	}
+	ids := make(map[string]struct{})
+	for _, h := range hosts {
+		if d.Port != 0 {
+			h.Port = d.Port
+		}
+		if _, exist := ids[h.Id]; exist {
+			h.Id = fmt.Sprintf("%s:%d", h.Id, h.Port)
+		}
+		ids[h.Id] = struct{}{}
+		h.Tags = append(append([]string(nil), d.Tags...), h.Tags...)
+		h.Auth = d.Auth
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Id < hosts[j].Id
+	})
+	return hosts, nil
+}
+
+// commandsHelpHeader follows the hosts list in the group help, discovered hosts are inserted before it
+const commandsHelpHeader = "\n_*Commands:*_"
+
+// WithDiscoveredHosts returns the config copy with the discovered hosts added to the discoveries groups
+// and their help. Static hosts take precedence over discovered ones with the same id.
+func (c *Config) WithDiscoveredHosts(discovered map[string][]*Host) *Config {
+	if len(discovered) == 0 {
+		return c
+	}
+	result := *c
+	result.Hosts = make(map[string]*Host, len(c.Hosts))
+	for id, h := range c.Hosts {
+		result.Hosts[id] = h
+	}
+	result.Groups = make(map[string]*Group, len(c.Groups))
+	for id, g := range c.Groups {
+		result.Groups[id] = g
+	}
+	added := make(map[string][]string)
+	for _, d := range c.Discoveries {
+		hosts, exist := discovered[d.Id]
+		if !exist {
+			continue
+		}
+		group := *result.Groups[d.Group]
+		group.Hosts = make(map[string]*Host, len(group.Hosts)+len(hosts))
+		for id, h := range result.Groups[d.Group].Hosts {
+			group.Hosts[id] = h
+		}
+		for _, h := range hosts {
+			if _, exist := result.Hosts[h.Id]; exist {
+				continue
+			}
+			result.Hosts[h.Id] = h
+			group.Hosts[h.Id] = h
+			added[group.Id] = append(added[group.Id], h.Id)
+		}
+		result.Groups[d.Group] = &group
+	}
+	for id, hosts := range added {
+		group := result.Groups[id]
+		i := strings.Index(group.Help, commandsHelpHeader)
+		if i < 0 {
+			continue
+		}
+		sort.Strings(hosts)
+		var help strings.Builder
+		help.WriteString(group.Help[:i])
+		for _, h := range hosts {
+			help.WriteString(fmt.Sprintf(" `%s`", h))
+		}
+		help.WriteString(group.Help[i:])
+		group.Help = help.String()
+	}
+	return &result
+}
+
+// buildDiscoveries validates discoveries and creates their providers
+func buildDiscoveries(internal *config, groups map[string]*Group, secrets *SecretResolver) ([]*Discovery, error) {
+	var discoveries []*Discovery
+	ids := make(map[string]struct{})
+	for _, d := range internal.Discoveries {
+		if d.Id == "" {
+			return nil, fmt.Errorf("discovery for service %q has empty id", d.Service)
+		}
+		if _, exist := ids[d.Id]; exist {
+			return nil, fmt.Errorf("duplicate discovery id %q", d.Id)
+		}
+		ids[d.Id] = struct{}{}
+		if _, exist := groups[d.Group]; !exist {
+			return nil, fmt.Errorf("discovery %q: group %q not found", d.Id, d.Group)
+		}
+		if d.Service == "" {
+			return nil, fmt.Errorf("discovery %q: service is not set", d.Id)
+		}
+		auth, err := buildAuth(d.Auth, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("discovery %q: %v", d.Id, err)
+		}
+		interval := defaultDiscoveryInterval
+		if d.Interval != "" {
+			interval, err = time.ParseDuration(d.Interval)
+			if err != nil {
+				return nil, fmt.Errorf("discovery %q: %v", d.Id, err)
+			}
+		}
+		discovery := &Discovery{
+			Id:       d.Id,
+			Type:     d.Type,
+			Service:  d.Service,
+			Address:  d.Address,
+			Tag:      d.Tag,
+			Port:     d.Port,
+			Interval: interval,
+			Group:    d.Group,
+			Tags:     d.Tags,
+			Auth:     auth,
+		}
+		switch d.Type {
+		case "dns":
+			discovery.Provider = &SRVProvider{Name: d.Service}
+		case "consul":
+			if d.Address == "" {
+				return nil, fmt.Errorf("discovery %q: catalog address is not set", d.Id)
+			}
+			discovery.Provider = &ConsulProvider{
+				Address: d.Address,
+				Service: d.Service,
+				Tag:     d.Tag,
+				Client:  &http.Client{Timeout: 10 * time.Second},
+			}
+		default:
+			return nil, fmt.Errorf("discovery %q: bad type %q", d.Id, d.Type)
+		}
+		discoveries = append(discoveries, discovery)
+	}
+	return discoveries, nil
+}
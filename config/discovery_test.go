@@ -0,0 +1,130 @@
+package config
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConsulProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/catalog/service/ssh" || r.URL.Query().Get("tag") != "web" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[
+			{"Node":"web1","Address":"10.0.0.1","ServiceAddress":"","ServicePort":22,"ServiceTags":["web"]},
+			{"Node":"web2","Address":"10.0.0.2","ServiceAddress":"192.168.0.2","ServicePort":2222,"ServiceTags":["web","eu"]}
+		]`))
+	}))
+	defer server.Close()
+
+	d := &Discovery{
+		Id:       "consul-web",
+		Provider: &ConsulProvider{Address: server.URL, Service: "ssh", Tag: "web"},
+		Tags:     []string{"consul"},
+		Auth:     &Auth{Type: "password", Username: "shmee"},
+	}
+	hosts, err := d.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Host{
+		{Id: "web1", Address: "10.0.0.1", Port: 22, Tags: []string{"consul", "web"}, Auth: d.Auth},
+		{Id: "web2", Address: "192.168.0.2", Port: 2222, Tags: []string{"consul", "web", "eu"}, Auth: d.Auth},
+	}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("Got hosts: %+v, want: %+v", hosts, expected)
+	}
+
+	d.Provider = &ConsulProvider{Address: server.URL, Service: "other"}
+	if _, err := d.Discover(); err == nil || err.Error() != `discovery "consul-web": catalog responded with status 404: ` {
+		t.Errorf("Got err: %v", err)
+	}
+}
+
+func TestSRVProvider(t *testing.T) {
+	d := &Discovery{
+		Id: "dns-web",
+		Provider: &SRVProvider{
+			Name: "_ssh._tcp.web.example.com",
+			resolver: func(service, proto, name string) (string, []*net.SRV, error) {
+				return "", []*net.SRV{
+					{Target: "web2.example.com.", Port: 22},
+					{Target: "web1.example.com.", Port: 22},
+					{Target: "web1.example.com.", Port: 2222},
+				}, nil
+			},
+		},
+		Port: 0,
+	}
+	hosts, err := d.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, h := range hosts {
+		ids = append(ids, h.Id)
+	}
+	if !reflect.DeepEqual(ids, []string{"web1.example.com", "web1.example.com:2222", "web2.example.com"}) {
+		t.Errorf("Got hosts ids: %q", ids)
+	}
+}
+
+func TestWithDiscoveredHosts(t *testing.T) {
+	conf, err := Parse(`
+[[group]]
+    id = "web"
+    hosts = ["static"]
+
+[[host]]
+    id = "static"
+    [host.auth]
+        type = "password"
+
+[[discovery]]
+    id = "dns-web"
+    type = "dns"
+    service = "_ssh._tcp.web.example.com"
+    interval = "30s"
+    group = "web"
+    [discovery.auth]
+        type = "publickey"
+        username = "deploy"
+        privateKeyPath = "/keys/web"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Discoveries) != 1 || conf.Discoveries[0].Interval.String() != "30s" {
+		t.Fatalf("Got discoveries: %+v", conf.Discoveries)
+	}
+
+	discovered := map[string][]*Host{
+		"dns-web": {{Id: "web1"}, {Id: "static", Address: "other"}},
+	}
+	result := conf.WithDiscoveredHosts(discovered)
+	if len(result.Groups["web"].Hosts) != 2 || result.Hosts["web1"] == nil || result.Hosts["static"].Address == "other" {
+		t.Errorf("Got hosts: %v, group hosts: %v", result.Hosts, result.Groups["web"].Hosts)
+	}
+	if help := result.Groups["web"].Help; !strings.Contains(help, "_*Hosts:*_ `static` `web1`\n_*Commands:*_") {
+		t.Errorf("Got group help: %q", help)
+	}
+	if len(conf.Groups["web"].Hosts) != 1 || len(conf.Hosts) != 1 || strings.Contains(conf.Groups["web"].Help, "web1") {
+		t.Errorf("Parsed config was changed")
+	}
+
+	errors := map[string]string{
+		"[[discovery]]\nid = \"d\"\ntype = \"dns\"\nservice = \"s\"\ngroup = \"none\"\n[discovery.auth]\ntype = \"password\"":                        `discovery "d": group "none" not found`,
+		"[[group]]\nid = \"g\"\n[[discovery]]\nid = \"d\"\ntype = \"ldap\"\nservice = \"s\"\ngroup = \"g\"\n[discovery.auth]\ntype = \"password\"":   `discovery "d": bad type "ldap"`,
+		"[[group]]\nid = \"g\"\n[[discovery]]\nid = \"d\"\ntype = \"consul\"\nservice = \"s\"\ngroup = \"g\"\n[discovery.auth]\ntype = \"password\"": `discovery "d": catalog address is not set`,
+	}
+	for data, want := range errors {
+		if _, err := Parse(data); err == nil || err.Error() != want {
+			t.Errorf("Got err: %v, want: %v", err, want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+)
+
+// defaultHistoryLimit is the number of stored executions
+const defaultHistoryLimit = 1000
+
+// History is the executions history settings
+type History struct {
+	Path  string
+	Limit int
+}
+
+// buildHistory validates the history settings, nil means the history is disabled
+func buildHistory(h history) (*History, error) {
+	if h.Path == "" {
+		return nil, nil
+	}
+	if h.Limit < 0 {
+		return nil, fmt.Errorf("history: bad limit %d", h.Limit)
+	}
+	limit := h.Limit
+	if limit == 0 {
+		limit = defaultHistoryLimit
+	}
+	return &History{Path: h.Path, Limit: limit}, nil
+}
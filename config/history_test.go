@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseHistory(t *testing.T) {
+	tests := []struct {
+		history string
+		want    *History
+		err     string
+	}{
+		{"", nil, ""},
+		{"path = \"/var/lib/bb8bot/history.db\"", &History{Path: "/var/lib/bb8bot/history.db", Limit: 1000}, ""},
+		{"path = \"history.db\"\nlimit = 50", &History{Path: "history.db", Limit: 50}, ""},
+		{"path = \"history.db\"\nlimit = -1", nil, "history: bad limit -1"},
+	}
+	for i, test := range tests {
+		conf, err := Parse(testScheduleConfig + "\n[settings.history]\n" + test.history)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: Got err: %v", i, err)
+			continue
+		}
+		if got := conf.Settings.History; (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+			t.Errorf("%d: Got history: %+v, want: %+v", i, got, test.want)
+		}
+	}
+}
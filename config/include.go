@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// loader reads config files following their includes and merges them into one config
+type loader struct {
+	merged   config
+	files    []string
+	includes []string
+	settings string
+	hosts    map[string]string
+	groups   map[string]string
+}
+
+// loadFiles reads the config file or all *.toml files of the config directory with their includes,
+// it returns the loaded files and the include patterns with absolute paths
+func loadFiles(configPath string) (*config, []string, []string, error) {
+	l := &loader{
+		hosts:  make(map[string]string),
+		groups: make(map[string]string),
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	paths := []string{configPath}
+	if info.IsDir() {
+		paths, err = filepath.Glob(filepath.Join(configPath, "*.toml"))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(paths) == 0 {
+			return nil, nil, nil, fmt.Errorf("no *.toml files found in %q", configPath)
+		}
+	}
+	for _, path := range paths {
+		if err := l.load(path); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return &l.merged, l.files, l.includes, nil
+}
+
+// load decodes the config file, merges it and loads its includes
+func (l *loader) load(path string) error {
+	path = filepath.Clean(path)
+	for _, f := range l.files {
+		if f == path {
+			return nil
+		}
+	}
+	l.files = append(l.files, path)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var c config
+	meta, err := toml.Decode(string(data), &c)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	c.resolvePaths(filepath.Dir(path))
+
+	if meta.IsDefined("settings") {
+		if l.settings != "" {
+			return fmt.Errorf("%s: settings are already defined in %q", path, l.settings)
+		}
+		l.settings = path
+		l.merged.Settings = c.Settings
+	}
+	for _, h := range c.Hosts {
+		if h.Id == "" {
+			// hosts imported from the OpenSSH config can omit ids
+			h.Id = h.SSHConfigHost
+		}
+		if source, exist := l.hosts[h.Id]; exist {
+			return fmt.Errorf("%s: duplicate host id %q, already defined in %q", path, h.Id, source)
+		}
+		l.hosts[h.Id] = path
+		h.source = path
+		l.merged.Hosts = append(l.merged.Hosts, h)
+	}
+	for _, g := range c.Groups {
+		if source, exist := l.groups[g.Id]; exist {
+			return fmt.Errorf("%s: duplicate group id %q, already defined in %q", path, g.Id, source)
+		}
+		l.groups[g.Id] = path
+		g.source = path
+		l.merged.Groups = append(l.merged.Groups, g)
+	}
+
+	l.merged.Discoveries = append(l.merged.Discoveries, c.Discoveries...)
+	l.merged.Auths = append(l.merged.Auths, c.Auths...)
+	l.merged.Schedules = append(l.merged.Schedules, c.Schedules...)
+	l.merged.Checks = append(l.merged.Checks, c.Checks...)
+	l.merged.Aliases = append(l.merged.Aliases, c.Aliases...)
+
+	for _, pattern := range c.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: bad include %q: %v", path, pattern, err)
+		}
+		l.addInclude(pattern)
+		sort.Strings(matches)
+		for _, match := range matches {
+			if err := l.load(match); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addInclude adds the include pattern if it isn't added yet
+func (l *loader) addInclude(pattern string) {
+	for _, p := range l.includes {
+		if p == pattern {
+			return
+		}
+	}
+	l.includes = append(l.includes, pattern)
+}
+
+// resolvePaths makes relative file paths of the config relative to the dir of the file declaring them
+func (c *config) resolvePaths(dir string) {
+	s := &c.Settings
+	for _, p := range []*string{&s.TokenFile, &s.Vault.TokenFile, &s.SSHConfig, &s.Inventory, &s.History.Path, &s.HTTP.SigningSecretFile} {
+		*p = relativeTo(dir, *p)
+	}
+	for i := range s.HTTP.Clients {
+		s.HTTP.Clients[i].TokenFile = relativeTo(dir, s.HTTP.Clients[i].TokenFile)
+	}
+	for i := range c.Hosts {
+		c.Hosts[i].Auth.resolvePaths(dir)
+	}
+	for i := range c.Auths {
+		c.Auths[i].resolvePaths(dir)
+	}
+	for i := range c.Discoveries {
+		c.Discoveries[i].Auth.resolvePaths(dir)
+	}
+}
+
+// resolvePaths makes relative file paths of the auth relative to the dir
+func (a *auth) resolvePaths(dir string) {
+	for _, p := range []*string{&a.PasswordFile, &a.PrivateKeyPath, &a.PassphraseFile} {
+		*p = relativeTo(dir, *p)
+	}
+}
+
+// relativeTo returns the relative path joined to the dir, absolute and home paths are returned as is
+func relativeTo(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) || path == "~" || strings.HasPrefix(path, "~/") {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// in returns the source file suffix for error messages
+func in(source string) string {
+	if source == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", source)
+}
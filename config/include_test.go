@@ -0,0 +1,194 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "bb8bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const (
+	testIncludeMain = `
+include = ["hosts/*.toml", "groups/*.toml"]
+[settings]
+    token = "xoxb-36484"
+`
+	testIncludeHosts = `
+[[host]]
+    id = "onehost"
+    address = "onehost"
+    port = 22
+    [host.auth]
+        type = "password"
+        username = "shmee"
+        password = "gayjke"
+`
+	testIncludeGroups = `
+[[group]]
+    id = "group1"
+    hosts = ["onehost"]
+    [[group.command]]
+        id = "cmd"
+        cmdFmt = "cmd"
+`
+)
+
+func TestParseFileIncludes(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"config.toml":       testIncludeMain,
+		"hosts/hosts.toml":  testIncludeHosts,
+		"groups/group.toml": testIncludeGroups,
+	})
+	defer os.RemoveAll(dir)
+
+	conf, err := ParseFile(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Settings.Token != "xoxb-36484" {
+		t.Errorf("Got token: %q", conf.Settings.Token)
+	}
+	if conf.Groups["group1"].Hosts["onehost"] != conf.Hosts["onehost"] || conf.Hosts["onehost"] == nil {
+		t.Errorf("Group host wasn't resolved from included file")
+	}
+	files := []string{
+		filepath.Join(dir, "config.toml"),
+		filepath.Join(dir, "hosts", "hosts.toml"),
+		filepath.Join(dir, "groups", "group.toml"),
+	}
+	if !reflect.DeepEqual(conf.Files, files) {
+		t.Errorf("Got files: %q, want: %q", conf.Files, files)
+	}
+	includes := []string{filepath.Join(dir, "hosts", "*.toml"), filepath.Join(dir, "groups", "*.toml")}
+	if !reflect.DeepEqual(conf.Includes, includes) {
+		t.Errorf("Got includes: %q, want: %q", conf.Includes, includes)
+	}
+}
+
+func TestParseFileIncludePaths(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"config.toml": "include = [\"conf.d/*.toml\"]\n",
+		"conf.d/settings.toml": `
+[settings]
+    tokenFile = "secrets/token"
+    sshConfig = "ssh_config"
+`,
+		"conf.d/secrets/token": "xoxb-36484\n",
+		"conf.d/ssh_config":    "Host web\n    HostName web.example.com\n",
+		"conf.d/hosts.toml": `
+[[host]]
+    sshConfigHost = "web"
+    [host.auth]
+        type = "password"
+        username = "shmee"
+        passwordFile = "secrets/password"
+`,
+		"conf.d/secrets/password": "gayjke\n",
+		"conf.d/groups.toml":      "[[group]]\n    id = \"group1\"\n    hosts = [\"web\"]\n",
+	})
+	defer os.RemoveAll(dir)
+
+	conf, err := ParseFile(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Settings.Token != "xoxb-36484" {
+		t.Errorf("Got token: %q", conf.Settings.Token)
+	}
+	web := conf.Hosts["web"]
+	if web == nil || web.Address != "web.example.com" || web.Auth.Password != "gayjke" {
+		t.Errorf("Got host: %+v", web)
+	}
+}
+
+func TestParseFileDirectory(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"config.toml": "[settings]\n    token = \"xoxb-36484\"\n",
+		"hosts.toml":  testIncludeHosts,
+		"groups.toml": testIncludeGroups,
+	})
+	defer os.RemoveAll(dir)
+
+	conf, err := ParseFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exist := conf.Groups["group1"]; !exist || len(conf.Hosts) != 1 {
+		t.Errorf("Got groups: %v, hosts: %v", conf.Groups, conf.Hosts)
+	}
+	files := append([]string(nil), conf.Files...)
+	sort.Strings(files)
+	if len(files) != 3 {
+		t.Errorf("Got files: %q", files)
+	}
+}
+
+func TestParseFileIncludeErrors(t *testing.T) {
+	tests := []struct {
+		files map[string]string
+		err   string
+	}{
+		{
+			map[string]string{
+				"config.toml":   testIncludeMain,
+				"hosts/a.toml":  testIncludeHosts,
+				"hosts/b.toml":  testIncludeHosts,
+				"groups/g.toml": testIncludeGroups,
+			},
+			`{dir}/hosts/b.toml: duplicate host id "onehost", already defined in "{dir}/hosts/a.toml"`,
+		},
+		{
+			map[string]string{
+				"config.toml":   testIncludeMain,
+				"hosts/a.toml":  testIncludeHosts,
+				"groups/a.toml": testIncludeGroups,
+				"groups/b.toml": testIncludeGroups,
+			},
+			`{dir}/groups/b.toml: duplicate group id "group1", already defined in "{dir}/groups/a.toml"`,
+		},
+		{
+			map[string]string{
+				"config.toml":   testIncludeMain,
+				"groups/a.toml": testIncludeGroups,
+			},
+			`group "group1" ({dir}/groups/a.toml): host "onehost" not found`,
+		},
+		{
+			map[string]string{
+				"config.toml":  testIncludeMain,
+				"hosts/a.toml": "[settings]\n    token = \"other\"\n",
+			},
+			`{dir}/hosts/a.toml: settings are already defined in "{dir}/config.toml"`,
+		},
+	}
+
+	for i, test := range tests {
+		dir := writeTestFiles(t, test.files)
+		_, err := ParseFile(filepath.Join(dir, "config.toml"))
+		want := strings.Replace(test.err, "{dir}", dir, -1)
+		if err == nil || err.Error() != want {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, want)
+		}
+		os.RemoveAll(dir)
+	}
+}
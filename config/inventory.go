@@ -0,0 +1,416 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// inventory is the Ansible inventory with groups, their hosts and variables
+type inventory struct {
+	path   string
+	groups map[string]*inventoryGroup
+	hosts  []string
+}
+
+type inventoryGroup struct {
+	hosts    map[string]map[string]string
+	vars     map[string]string
+	children []string
+}
+
+type yamlInventoryGroup struct {
+	Hosts    map[string]map[string]interface{} `yaml:"hosts"`
+	Vars     map[string]interface{}            `yaml:"vars"`
+	Children map[string]*yamlInventoryGroup    `yaml:"children"`
+}
+
+// parseInventoryFile reads the Ansible inventory in the YAML (*.yml, *.yaml) or INI format
+func parseInventoryFile(path string) (*inventory, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var inv *inventory
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		inv, err = parseYAMLInventory(data)
+	default:
+		inv, err = parseINIInventory(strings.NewReader(string(data)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	inv.path = path
+	return inv, nil
+}
+
+func newInventory() *inventory {
+	return &inventory{groups: make(map[string]*inventoryGroup)}
+}
+
+// group returns the inventory group by name creating it if it doesn't exist
+func (inv *inventory) group(name string) *inventoryGroup {
+	g, exist := inv.groups[name]
+	if !exist {
+		g = &inventoryGroup{
+			hosts: make(map[string]map[string]string),
+			vars:  make(map[string]string),
+		}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+// addHost adds the host with variables to the group
+func (inv *inventory) addHost(group, name string, vars map[string]string) {
+	g := inv.group(group)
+	hostVars, exist := g.hosts[name]
+	if !exist {
+		hostVars = make(map[string]string)
+		g.hosts[name] = hostVars
+	}
+	for k, v := range vars {
+		hostVars[k] = v
+	}
+	for _, h := range inv.hosts {
+		if h == name {
+			return
+		}
+	}
+	inv.hosts = append(inv.hosts, name)
+}
+
+// parseYAMLInventory parses the YAML inventory
+func parseYAMLInventory(data []byte) (*inventory, error) {
+	var root map[string]*yamlInventoryGroup
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	inv := newInventory()
+	var walk func(name string, g *yamlInventoryGroup)
+	walk = func(name string, g *yamlInventoryGroup) {
+		group := inv.group(name)
+		if g == nil {
+			return
+		}
+		for k, v := range g.Vars {
+			group.vars[k] = fmt.Sprint(v)
+		}
+		hosts := make([]string, 0, len(g.Hosts))
+		for h := range g.Hosts {
+			hosts = append(hosts, h)
+		}
+		sort.Strings(hosts)
+		for _, h := range hosts {
+			vars := make(map[string]string)
+			for k, v := range g.Hosts[h] {
+				vars[k] = fmt.Sprint(v)
+			}
+			inv.addHost(name, h, vars)
+		}
+		for _, c := range sortedGroups(g.Children) {
+			group.children = append(group.children, c)
+			walk(c, g.Children[c])
+		}
+	}
+	for _, name := range sortedGroups(root) {
+		walk(name, root[name])
+	}
+	return inv, nil
+}
+
+// parseINIInventory parses the INI inventory with [group], [group:vars] and [group:children] sections
+func parseINIInventory(r io.Reader) (*inventory, error) {
+	inv := newInventory()
+	section, kind := "ungrouped", "hosts"
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			section, kind = text[1:len(text)-1], "hosts"
+			if i := strings.Index(section, ":"); i != -1 {
+				section, kind = section[:i], section[i+1:]
+			}
+			if kind != "hosts" && kind != "vars" && kind != "children" {
+				return nil, fmt.Errorf("line %d: unknown section type %q", line, kind)
+			}
+			inv.group(section)
+			continue
+		}
+		switch kind {
+		case "hosts":
+			fields := strings.Fields(text)
+			vars := make(map[string]string)
+			for _, f := range fields[1:] {
+				kv := strings.SplitN(f, "=", 2)
+				if len(kv) != 2 {
+					return nil, fmt.Errorf("line %d: bad host variable %q", line, f)
+				}
+				vars[kv[0]] = strings.Trim(kv[1], `"'`)
+			}
+			names, err := expandInventoryHost(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			for _, name := range names {
+				inv.addHost(section, name, vars)
+			}
+		case "vars":
+			kv := strings.SplitN(text, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("line %d: bad group variable %q", line, text)
+			}
+			inv.group(section).vars[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+		case "children":
+			g := inv.group(section)
+			g.children = append(g.children, text)
+			inv.group(text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// expandInventoryHost expands the numeric range pattern like "web[01:03].example.com"
+func expandInventoryHost(pattern string) ([]string, error) {
+	start := strings.Index(pattern, "[")
+	end := strings.Index(pattern, "]")
+	if start == -1 || end < start {
+		return []string{pattern}, nil
+	}
+	bounds := strings.Split(pattern[start+1:end], ":")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("bad host range %q", pattern)
+	}
+	from, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return nil, fmt.Errorf("bad host range %q", pattern)
+	}
+	to, err := strconv.Atoi(bounds[1])
+	if err != nil || to < from {
+		return nil, fmt.Errorf("bad host range %q", pattern)
+	}
+	var names []string
+	for i := from; i <= to; i++ {
+		n := fmt.Sprintf("%0*d", len(bounds[0]), i)
+		rest, err := expandInventoryHost(pattern[end+1:])
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rest {
+			names = append(names, pattern[:start]+n+r)
+		}
+	}
+	return names, nil
+}
+
+// parents returns parent groups for each group
+func (inv *inventory) parents() map[string][]string {
+	parents := make(map[string][]string)
+	for name, g := range inv.groups {
+		for _, c := range g.children {
+			parents[c] = append(parents[c], name)
+		}
+	}
+	return parents
+}
+
+// depths returns the longest distance from top level groups for each group,
+// so child groups variables could override parent ones
+func (inv *inventory) depths(parents map[string][]string) map[string]int {
+	depths := make(map[string]int)
+	var depth func(name string, level int) int
+	depth = func(name string, level int) int {
+		if d, exist := depths[name]; exist {
+			return d
+		}
+		d := 0
+		// level guards against cycles in children sections
+		if level < len(inv.groups) {
+			for _, p := range parents[name] {
+				if pd := depth(p, level+1) + 1; pd > d {
+					d = pd
+				}
+			}
+		}
+		depths[name] = d
+		return d
+	}
+	for name := range inv.groups {
+		depth(name, 0)
+	}
+	return depths
+}
+
+// membership returns the groups of each host including parent groups
+func (inv *inventory) membership(parents map[string][]string) map[string]map[string]struct{} {
+	member := make(map[string]map[string]struct{})
+	var add func(group, host string)
+	add = func(group, host string) {
+		if _, exist := member[host][group]; exist {
+			return
+		}
+		member[host][group] = struct{}{}
+		for _, parent := range parents[group] {
+			add(parent, host)
+		}
+	}
+	for _, h := range inv.hosts {
+		member[h] = make(map[string]struct{})
+		for name, g := range inv.groups {
+			if _, exist := g.hosts[h]; exist {
+				add(name, h)
+			}
+		}
+	}
+	return member
+}
+
+// groupHosts returns the hosts of each group including hosts of its children
+func (inv *inventory) groupHosts() map[string][]string {
+	hosts := make(map[string][]string, len(inv.groups))
+	for name := range inv.groups {
+		hosts[name] = nil
+	}
+	member := inv.membership(inv.parents())
+	for _, h := range inv.hosts {
+		for name := range member[h] {
+			hosts[name] = append(hosts[name], h)
+		}
+	}
+	return hosts
+}
+
+// toHosts converts inventory hosts to config hosts with inventory groups as tags
+func (inv *inventory) toHosts() ([]host, error) {
+	parents := inv.parents()
+	depths := inv.depths(parents)
+	names := make([]string, 0, len(inv.groups))
+	for name := range inv.groups {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if depths[names[i]] != depths[names[j]] {
+			return depths[names[i]] < depths[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	member := inv.membership(parents)
+	hosts := make([]host, 0, len(inv.hosts))
+	for _, name := range inv.hosts {
+		vars := make(map[string]string)
+		for k, v := range inv.group("all").vars {
+			vars[k] = v
+		}
+		var tags []string
+		for _, g := range names {
+			if _, exist := member[name][g]; !exist {
+				continue
+			}
+			if g != "all" && g != "ungrouped" {
+				tags = append(tags, g)
+			}
+			for k, v := range inv.groups[g].vars {
+				vars[k] = v
+			}
+		}
+		for _, g := range names {
+			for k, v := range inv.groups[g].hosts[name] {
+				vars[k] = v
+			}
+		}
+		sort.Strings(tags)
+
+		h := host{
+			Id:      name,
+			Address: name,
+			Port:    22,
+			Tags:    tags,
+			source:  inv.path,
+		}
+		if v := vars["ansible_host"]; v != "" {
+			h.Address = v
+		}
+		if v := vars["ansible_port"]; v != "" {
+			port, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("inventory host %q: bad ansible_port %q", name, v)
+			}
+			h.Port = port
+		}
+		h.Auth.Username = vars["ansible_user"]
+		if password := firstNotEmpty(vars["ansible_password"], vars["ansible_ssh_pass"]); password != "" {
+			h.Auth.Type = "password"
+			h.Auth.Password = password
+		} else {
+			h.Auth.Type = "publickey"
+			h.Auth.PrivateKeyPath = expandHome(firstNotEmpty(vars["ansible_ssh_private_key_file"], "~/.ssh/id_rsa"))
+		}
+		if h.Auth.Username == "" {
+			h.Auth.Username = os.Getenv("USER")
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// importInventory adds hosts from the Ansible inventory, hosts from the bot config take precedence.
+// The hosts of inventory groups are kept for the groups with inventoryGroups.
+func importInventory(internal *config) error {
+	if internal.Settings.Inventory == "" {
+		return nil
+	}
+	inv, err := parseInventoryFile(internal.Settings.Inventory)
+	if err != nil {
+		return err
+	}
+	hosts, err := inv.toHosts()
+	if err != nil {
+		return err
+	}
+	internal.inventoryGroups = inv.groupHosts()
+	ids := make(map[string]struct{})
+	for _, h := range internal.Hosts {
+		ids[h.Id] = struct{}{}
+	}
+	for _, h := range hosts {
+		if _, exist := ids[h.Id]; !exist {
+			internal.Hosts = append(internal.Hosts, h)
+		}
+	}
+	return nil
+}
+
+func firstNotEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func sortedGroups(groups map[string]*yamlInventoryGroup) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
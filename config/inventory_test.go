@@ -0,0 +1,194 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var testINIInventory = `
+mail.example.com
+
+[web]
+web[01:02].example.com ansible_port=2222
+other.example.com ansible_host=10.0.0.3 ansible_password='secret'
+
+[web:vars]
+ansible_user=deploy
+ansible_ssh_private_key_file=/keys/web
+
+[prod:children]
+web
+
+[prod:vars]
+ansible_user=root
+ansible_port=22022
+`
+
+var testYAMLInventory = `
+all:
+  hosts:
+    mail.example.com:
+  vars:
+    ansible_user: root
+  children:
+    prod:
+      vars:
+        ansible_port: 22022
+      children:
+        web:
+          hosts:
+            web01.example.com:
+              ansible_port: 2222
+            web02.example.com:
+              ansible_port: 2222
+            other.example.com:
+              ansible_host: 10.0.0.3
+              ansible_password: secret
+          vars:
+            ansible_user: deploy
+            ansible_ssh_private_key_file: /keys/web
+`
+
+func TestInventory(t *testing.T) {
+	user := os.Getenv("USER")
+	os.Setenv("USER", "bb8")
+	defer os.Setenv("USER", user)
+	expected := []host{
+		{Id: "mail.example.com", Address: "mail.example.com", Port: 22, Auth: auth{Type: "publickey", Username: "{user}", PrivateKeyPath: "{home}/.ssh/id_rsa"}},
+		{Id: "web01.example.com", Address: "web01.example.com", Port: 2222, Tags: []string{"prod", "web"}, Auth: auth{Type: "publickey", Username: "deploy", PrivateKeyPath: "/keys/web"}},
+		{Id: "web02.example.com", Address: "web02.example.com", Port: 2222, Tags: []string{"prod", "web"}, Auth: auth{Type: "publickey", Username: "deploy", PrivateKeyPath: "/keys/web"}},
+		{Id: "other.example.com", Address: "10.0.0.3", Port: 22022, Tags: []string{"prod", "web"}, Auth: auth{Type: "password", Username: "deploy", Password: "secret"}},
+	}
+
+	tests := []struct {
+		name string
+		data string
+		user string
+	}{
+		{"inventory.ini", testINIInventory, "bb8"},
+		{"inventory.yml", testYAMLInventory, "root"},
+	}
+	for _, test := range tests {
+		dir := writeTestFiles(t, map[string]string{test.name: test.data})
+		path := filepath.Join(dir, test.name)
+		inv, err := parseInventoryFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts, err := inv.toHosts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		byId := make(map[string]host)
+		for _, h := range hosts {
+			byId[h.Id] = h
+		}
+		for _, e := range expected {
+			e.source = path
+			e.Auth.Username = strings.Replace(e.Auth.Username, "{user}", test.user, 1)
+			e.Auth.PrivateKeyPath = strings.Replace(e.Auth.PrivateKeyPath, "{home}", expandHome("~"), 1)
+			if !reflect.DeepEqual(byId[e.Id], e) {
+				t.Errorf("%s: Got host: %+v, want: %+v", test.name, byId[e.Id], e)
+			}
+		}
+		if len(hosts) != len(expected) {
+			t.Errorf("%s: Got %d hosts, want: %d", test.name, len(hosts), len(expected))
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestParseInventory(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"config.toml": `
+[settings]
+    inventory = "inventory.ini"
+
+[[group]]
+    id = "web"
+    tags = "web"
+
+[[host]]
+    id = "web01.example.com"
+    address = "override"
+    [host.auth]
+        type = "password"
+`,
+		"inventory.ini": testINIInventory,
+	})
+	defer os.RemoveAll(dir)
+
+	conf, err := ParseFile(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Hosts) != 4 || conf.Hosts["web01.example.com"].Address != "override" {
+		t.Errorf("Got hosts: %v", conf.Hosts)
+	}
+	hosts := conf.Groups["web"].Hosts
+	if len(hosts) != 2 || hosts["web02.example.com"] == nil || hosts["other.example.com"] == nil {
+		t.Errorf("Got group hosts: %v", hosts)
+	}
+}
+
+func TestParseInventoryGroups(t *testing.T) {
+	for _, name := range []string{"inventory.ini", "inventory.yml"} {
+		data := testINIInventory
+		if name == "inventory.yml" {
+			data = testYAMLInventory
+		}
+		dir := writeTestFiles(t, map[string]string{
+			"config.toml": `
+[settings]
+    inventory = "` + name + `"
+
+[[group]]
+    id = "prod"
+    inventoryGroups = ["prod"]
+
+[[host]]
+    id = "web01.example.com"
+    address = "override"
+    [host.auth]
+        type = "password"
+`,
+			name: data,
+		})
+		conf, err := ParseFile(filepath.Join(dir, "config.toml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for id, h := range conf.Groups["prod"].Hosts {
+			if h != conf.Hosts[id] {
+				t.Errorf("%s: Got host %q not from config hosts", name, id)
+			}
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		want := []string{"other.example.com", "web01.example.com", "web02.example.com"}
+		if !reflect.DeepEqual(ids, want) {
+			t.Errorf("%s: Got prod hosts: %q, want: %q", name, ids, want)
+		}
+		if conf.Groups["prod"].Hosts["web01.example.com"].Address != "override" {
+			t.Errorf("%s: Got inventory host instead of the bot config one", name)
+		}
+		if !strings.Contains(conf.Groups["prod"].Help, "`web02.example.com`") {
+			t.Errorf("%s: Got help: %q", name, conf.Groups["prod"].Help)
+		}
+		os.RemoveAll(dir)
+	}
+
+	dir := writeTestFiles(t, map[string]string{
+		"config.toml":   "[settings]\n    inventory = \"inventory.ini\"\n[[group]]\n    id = \"db\"\n    inventoryGroups = [\"db\"]\n",
+		"inventory.ini": testINIInventory,
+	})
+	defer os.RemoveAll(dir)
+	if _, err := ParseFile(filepath.Join(dir, "config.toml")); err == nil || !strings.Contains(err.Error(), `inventory group "db" not found`) {
+		t.Errorf("Got error for unknown inventory group: %v", err)
+	}
+}
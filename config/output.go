@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"github.com/karlovskiy/bb8bot/jsonpath"
+)
+
+// Command output formats
+const (
+	OutputRaw   = "raw"
+	OutputJSON  = "json"
+	OutputTable = "table"
+)
+
+// Output is the structured command output rendering, nil means the raw output
+type Output struct {
+	// Format is OutputJSON or OutputTable
+	Format string
+	// JSONPath selects the rendered value of the json output, nil means the whole document
+	JSONPath *jsonpath.Path
+	// Columns are the rendered table headers or json object keys in order, empty means all
+	Columns []string
+}
+
+// buildOutput returns the command output rendering or nil for the raw output
+func buildOutput(c command) (*Output, error) {
+	switch c.Output {
+	case "", OutputRaw:
+		if c.JSONPath != "" || len(c.Columns) > 0 {
+			return nil, fmt.Errorf("jsonPath and columns require json or table output")
+		}
+		return nil, nil
+	case OutputJSON, OutputTable:
+	default:
+		return nil, fmt.Errorf("unknown output %q, expected raw, json or table", c.Output)
+	}
+	output := &Output{Format: c.Output, Columns: c.Columns}
+	if c.JSONPath != "" {
+		if c.Output != OutputJSON {
+			return nil, fmt.Errorf("jsonPath requires json output")
+		}
+		var err error
+		output.JSONPath, err = jsonpath.Parse(c.JSONPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const testOutputConfig = `
+[[group]]
+    id = "k8s"
+    hosts = ["onehost"]
+    [[group.command]]
+        id = "pods"
+        cmdFmt = "kubectl get pods"
+%s
+
+[[host]]
+    id = "onehost"
+    [host.auth]
+        type = "password"
+`
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		command string
+		output  *Output
+		err     string
+	}{
+		{"", nil, ""},
+		{`output = "raw"`, nil, ""},
+		{`output = "table"` + "\ncolumns = [\"NAME\", \"STATUS\"]", &Output{Format: OutputTable, Columns: []string{"NAME", "STATUS"}}, ""},
+		{`output = "json"` + "\njsonPath = \"$.items[*].metadata\"", &Output{Format: OutputJSON, JSONPath: mustJSONPath("$.items[*].metadata")}, ""},
+		{`output = "yaml"`, nil, `group "k8s": command "pods": unknown output "yaml", expected raw, json or table`},
+		{`columns = ["NAME"]`, nil, `group "k8s": command "pods": jsonPath and columns require json or table output`},
+		{`output = "table"` + "\njsonPath = \"$.a\"", nil, `group "k8s": command "pods": jsonPath requires json output`},
+		{`output = "json"` + "\njsonPath = \"$.a[\"", nil, `group "k8s": command "pods": bad json path "$.a[": missing ]`},
+	}
+	for i, test := range tests {
+		conf, err := Parse(fmt.Sprintf(testOutputConfig, test.command))
+		var e string
+		if err != nil {
+			e = err.Error()
+		}
+		if e != test.err {
+			t.Errorf("%d: Got err: %v, want: %v", i, e, test.err)
+		}
+		if err != nil {
+			continue
+		}
+		if output := conf.Groups["k8s"].Commands["pods"].Output; !reflect.DeepEqual(output, test.output) {
+			t.Errorf("%d: Got output: %+v, want: %+v", i, output, test.output)
+		}
+	}
+}
+
+func TestParseCodeBlock(t *testing.T) {
+	tests := []struct {
+		settings string
+		command  string
+		code     bool
+	}{
+		{"", "", false},
+		{"[settings]\ncodeBlock = true\n", "", true},
+		{"[settings]\ncodeBlock = true\n", "codeBlock = false", false},
+		{"", "codeBlock = true", true},
+	}
+	for i, test := range tests {
+		conf, err := Parse(test.settings + fmt.Sprintf(testOutputConfig, test.command))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code := conf.Groups["k8s"].Commands["pods"].CodeBlock; code != test.code {
+			t.Errorf("%d: Got code block: %v, want: %v", i, code, test.code)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// buildRedactions compiles the output redaction rules, nil if they are not set
+func buildRedactions(rules []string) ([]*regexp.Regexp, error) {
+	var redactions []*regexp.Regexp
+	for _, rule := range rules {
+		r, err := regexp.Compile(rule)
+		if err != nil {
+			return nil, fmt.Errorf("bad redact rule %q: %v", rule, err)
+		}
+		if r.MatchString("") {
+			return nil, fmt.Errorf("bad redact rule %q: matches empty string", rule)
+		}
+		redactions = append(redactions, r)
+	}
+	return redactions, nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseRedactions(t *testing.T) {
+	conf, err := Parse("[settings]\nredact = [\"sk_live_\\\\w+\"]\n" + fmt.Sprintf(testOutputConfig, `redact = ["DB_URL=\\w+://\\w+:(\\w+)@"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := conf.Settings.Redactions; len(r) != 1 || r[0].String() != `sk_live_\w+` {
+		t.Errorf("Got settings redactions: %v", r)
+	}
+	if r := conf.Groups["k8s"].Commands["pods"].Redactions; len(r) != 1 || r[0].String() != `DB_URL=\w+://\w+:(\w+)@` {
+		t.Errorf("Got command redactions: %v", r)
+	}
+
+	tests := []struct {
+		settings string
+		command  string
+		err      string
+	}{
+		{"[settings]\nredact = [\"(\"]\n", "", "settings: bad redact rule \"(\": error parsing regexp: missing closing ): `(`"},
+		{"", `redact = ["a*"]`, `group "k8s": command "pods": bad redact rule "a*": matches empty string`},
+	}
+	for i, test := range tests {
+		_, err := Parse(test.settings + fmt.Sprintf(testOutputConfig, test.command))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"strings"
+	"time"
+)
+
+// Schedule is the recurring group command execution with output posted to the channel
+type Schedule struct {
+	Id       string
+	Spec     string
+	Location *time.Location
+	Group    string
+	Host     string
+	Command  string
+	Args     []string
+	Channel  string
+}
+
+// CronSpec returns the cron spec with the schedule timezone
+func (s *Schedule) CronSpec() string {
+	return fmt.Sprintf("CRON_TZ=%s %s", s.Location, s.Spec)
+}
+
+// Action returns the chat action text for the schedule: <group> [host] <command> [args]
+func (s *Schedule) Action() string {
+	return actionText(s.Group, s.Host, s.Command, s.Args)
+}
+
+// actionText joins the chat action parts skipping the empty host
+func actionText(group, host, command string, args []string) string {
+	parts := []string{group}
+	if host != "" {
+		parts = append(parts, host)
+	}
+	parts = append(parts, command)
+	parts = append(parts, args...)
+	return strings.Join(parts, " ")
+}
+
+// buildSchedules validates schedules cron specs, timezones and group commands
+func buildSchedules(internal *config, external *Config) ([]*Schedule, error) {
+	var schedules []*Schedule
+	ids := make(map[string]struct{})
+	for _, s := range internal.Schedules {
+		if s.Id == "" {
+			return nil, fmt.Errorf("schedule for command %q has empty id", s.Command)
+		}
+		if _, exist := ids[s.Id]; exist {
+			return nil, fmt.Errorf("duplicate schedule id %q", s.Id)
+		}
+		ids[s.Id] = struct{}{}
+
+		location := time.Local
+		if s.Timezone != "" {
+			var err error
+			location, err = time.LoadLocation(s.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("schedule %q: %v", s.Id, err)
+			}
+		}
+		schedule := &Schedule{
+			Id:       s.Id,
+			Spec:     s.Cron,
+			Location: location,
+			Group:    s.Group,
+			Host:     s.Host,
+			Command:  s.Command,
+			Args:     s.Args,
+			Channel:  s.Channel,
+		}
+		if _, err := cron.ParseStandard(schedule.CronSpec()); err != nil {
+			return nil, fmt.Errorf("schedule %q: bad cron spec %q: %v", s.Id, s.Cron, err)
+		}
+		group, exist := external.Groups[s.Group]
+		if !exist {
+			return nil, fmt.Errorf("schedule %q: group %q not found", s.Id, s.Group)
+		}
+		if _, exist := group.Commands[s.Command]; !exist {
+			return nil, fmt.Errorf("schedule %q: command %q not found in group %q", s.Id, s.Command, s.Group)
+		}
+		if _, exist := group.Hosts[s.Host]; s.Host != "" && !strings.HasPrefix(s.Host, "@") && !exist {
+			return nil, fmt.Errorf("schedule %q: host %q not found in group %q", s.Id, s.Host, s.Group)
+		}
+		if s.Channel == "" {
+			return nil, fmt.Errorf("schedule %q: channel is not set", s.Id)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"testing"
+)
+
+const testScheduleConfig = `
+[[group]]
+    id = "unix"
+    hosts = ["onehost"]
+    [[group.command]]
+        id = "lsof"
+        cmdFmt = "lsof -i %s"
+        arguments = ["protocol"]
+    [[group.argument]]
+        id = "protocol"
+        [[group.argument.item]]
+            name = "ssh"
+            value = ":22"
+
+[[host]]
+    id = "onehost"
+    [host.auth]
+        type = "password"
+`
+
+func TestParseSchedules(t *testing.T) {
+	conf, err := Parse(testScheduleConfig + `
+[[schedule]]
+    id = "morning-lsof"
+    cron = "0 9 * * 1-5"
+    timezone = "Europe/Moscow"
+    group = "unix"
+    host = "onehost"
+    command = "lsof"
+    args = ["ssh"]
+    channel = "CRKR3KRN3"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Schedules) != 1 {
+		t.Fatalf("Got schedules: %v", conf.Schedules)
+	}
+	s := conf.Schedules[0]
+	if action := s.Action(); action != "unix onehost lsof ssh" {
+		t.Errorf("Got action: %q", action)
+	}
+	if spec := s.CronSpec(); spec != "CRON_TZ=Europe/Moscow 0 9 * * 1-5" {
+		t.Errorf("Got cron spec: %q", spec)
+	}
+
+	tests := []struct {
+		schedule string
+		err      string
+	}{
+		{
+			"id = \"s\"\ncron = \"0 9 * *\"\ngroup = \"unix\"\ncommand = \"lsof\"\nchannel = \"C\"",
+			`schedule "s": bad cron spec "0 9 * *": expected exactly 5 fields, found 4: [0 9 * *]`,
+		},
+		{
+			"id = \"s\"\ncron = \"@hourly\"\ntimezone = \"Mars/Base\"\ngroup = \"unix\"\ncommand = \"lsof\"\nchannel = \"C\"",
+			`schedule "s": unknown time zone Mars/Base`,
+		},
+		{
+			"id = \"s\"\ncron = \"@hourly\"\ngroup = \"none\"\ncommand = \"lsof\"\nchannel = \"C\"",
+			`schedule "s": group "none" not found`,
+		},
+		{
+			"id = \"s\"\ncron = \"@hourly\"\ngroup = \"unix\"\ncommand = \"none\"\nchannel = \"C\"",
+			`schedule "s": command "none" not found in group "unix"`,
+		},
+		{
+			"id = \"s\"\ncron = \"@hourly\"\ngroup = \"unix\"\nhost = \"none\"\ncommand = \"lsof\"\nchannel = \"C\"",
+			`schedule "s": host "none" not found in group "unix"`,
+		},
+		{
+			"id = \"s\"\ncron = \"@hourly\"\ngroup = \"unix\"\ncommand = \"lsof\"",
+			`schedule "s": channel is not set`,
+		},
+	}
+	for i, test := range tests {
+		_, err := Parse(testScheduleConfig + "\n[[schedule]]\n" + test.schedule)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+		}
+	}
+}
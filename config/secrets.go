@@ -0,0 +1,257 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultScheme is the secret reference scheme for the vault provider
+const vaultScheme = "vault"
+
+var envVarRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveSecret returns the secret read from the file if it is set,
+// otherwise the value with interpolated environment variables.
+func resolveSecret(name, value, file string) (string, error) {
+	if file != "" {
+		if value != "" {
+			return "", fmt.Errorf("%s: both value and file are set", name)
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	secret, err := interpolate(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	return secret, nil
+}
+
+// interpolate replaces ${ENV_VAR} references with the environment variables values
+func interpolate(value string) (string, error) {
+	var err error
+	result := envVarRegexp.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envVarRegexp.FindStringSubmatch(ref)[1]
+		v, exist := os.LookupEnv(name)
+		if !exist && err == nil {
+			err = fmt.Errorf("environment variable %q is not set", name)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// SecretProvider reads secrets from an external secret storage
+type SecretProvider interface {
+	// ReadSecret returns the secret data stored by path and its lease duration.
+	// Zero lease duration means that resolver default TTL is used.
+	ReadSecret(path string) (map[string]string, time.Duration, error)
+}
+
+// SecretResolver resolves secret references like "vault:secret/data/ssh#password"
+// with registered providers and caches the read secrets until their leases expire.
+// It remembers the resolved secrets, so they are redacted even after rotation.
+type SecretResolver struct {
+	providers  map[string]SecretProvider
+	defaultTTL time.Duration
+	mu         sync.Mutex
+	cache      map[string]*cachedSecret
+	resolved   map[string]struct{}
+	onResolve  func(secret string)
+	now        func() time.Time
+}
+
+type cachedSecret struct {
+	data    map[string]string
+	expires time.Time
+}
+
+// NewSecretResolver returns the resolver with providers by reference scheme
+func NewSecretResolver(providers map[string]SecretProvider, defaultTTL time.Duration) *SecretResolver {
+	return &SecretResolver{
+		providers:  providers,
+		defaultTTL: defaultTTL,
+		cache:      make(map[string]*cachedSecret),
+		resolved:   make(map[string]struct{}),
+		now:        time.Now,
+	}
+}
+
+// IsReference reports whether the value is a secret reference with a known scheme
+func (r *SecretResolver) IsReference(value string) bool {
+	if r == nil {
+		return false
+	}
+	_, _, _, err := r.parseReference(value)
+	return err == nil
+}
+
+// Resolve returns the secret for the reference or the value itself if it is not a reference
+func (r *SecretResolver) Resolve(value string) (string, error) {
+	if !r.IsReference(value) {
+		return value, nil
+	}
+	scheme, path, key, _ := r.parseReference(value)
+
+	cacheKey := scheme + ":" + path
+	r.mu.Lock()
+	cached, exist := r.cache[cacheKey]
+	r.mu.Unlock()
+	if !exist || !r.now().Before(cached.expires) {
+		// the provider is read without the lock, so a slow storage doesn't block other secrets
+		data, ttl, err := r.providers[scheme].ReadSecret(path)
+		if err != nil {
+			return "", fmt.Errorf("error reading secret %q: %v", scheme+":"+path, err)
+		}
+		if ttl <= 0 {
+			ttl = r.defaultTTL
+		}
+		cached = &cachedSecret{data: data, expires: r.now().Add(ttl)}
+		r.mu.Lock()
+		r.cache[cacheKey] = cached
+		r.mu.Unlock()
+	}
+	secret, exist := cached.data[key]
+	if !exist {
+		return "", fmt.Errorf("secret %q doesn't contain key %q", scheme+":"+path, key)
+	}
+
+	r.mu.Lock()
+	_, known := r.resolved[secret]
+	r.resolved[secret] = struct{}{}
+	onResolve := r.onResolve
+	r.mu.Unlock()
+	if !known && onResolve != nil {
+		onResolve(secret)
+	}
+	return secret, nil
+}
+
+// OnResolve sets the function called with each newly resolved secret
+func (r *SecretResolver) OnResolve(f func(secret string)) {
+	r.mu.Lock()
+	r.onResolve = f
+	r.mu.Unlock()
+}
+
+// Resolved returns the secrets resolved by references
+func (r *SecretResolver) Resolved() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	secrets := make([]string, 0, len(r.resolved))
+	for s := range r.resolved {
+		secrets = append(secrets, s)
+	}
+	sort.Strings(secrets)
+	return secrets
+}
+
+// Refresh drops the cached secret for the reference, so it will be read again on next resolve
+func (r *SecretResolver) Refresh(value string) {
+	if !r.IsReference(value) {
+		return
+	}
+	scheme, path, _, _ := r.parseReference(value)
+	r.mu.Lock()
+	delete(r.cache, scheme+":"+path)
+	r.mu.Unlock()
+}
+
+// parseReference splits the "<scheme>:<path>#<key>" reference
+func (r *SecretResolver) parseReference(value string) (scheme, path, key string, err error) {
+	i := strings.Index(value, ":")
+	if i <= 0 {
+		return "", "", "", fmt.Errorf("%q is not a secret reference", value)
+	}
+	scheme = value[:i]
+	if _, exist := r.providers[scheme]; !exist {
+		return "", "", "", fmt.Errorf("unknown secret provider %q", scheme)
+	}
+	j := strings.LastIndex(value, "#")
+	if j < i || value[i+1:j] == "" || value[j+1:] == "" {
+		return "", "", "", fmt.Errorf("bad secret reference %q, expected <scheme>:<path>#<key>", value)
+	}
+	return scheme, value[i+1 : j], value[j+1:], nil
+}
+
+// validateReference checks the reference syntax if the value looks like a vault secret reference
+func (r *SecretResolver) validateReference(name, value string) error {
+	if !strings.HasPrefix(value, vaultScheme+":") {
+		return nil
+	}
+	if r == nil {
+		return fmt.Errorf("%s: vault is not configured for secret reference %q", name, value)
+	}
+	if _, _, _, err := r.parseReference(value); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// Secrets returns the config secret values for redaction: the token, auth passwords and passphrases,
+// API clients tokens, the Slack signing secret, the Vault token and the secrets resolved by references so far.
+// Use OnSecretResolved to learn the secrets resolved later.
+func (c *Config) Secrets() []string {
+	var secrets []string
+	add := func(values ...string) {
+		for _, v := range values {
+			if v != "" {
+				secrets = append(secrets, v)
+			}
+		}
+	}
+	addAuth := func(a *Auth) {
+		if a == nil {
+			return
+		}
+		for _, v := range []string{a.Password, a.Passphrase} {
+			if !a.secrets.IsReference(v) {
+				add(v)
+			}
+		}
+	}
+	add(c.Settings.Token)
+	if c.secrets != nil {
+		for _, p := range c.secrets.providers {
+			if v, ok := p.(*VaultProvider); ok {
+				add(v.Token)
+			}
+		}
+		add(c.secrets.Resolved()...)
+	}
+	for _, h := range c.Hosts {
+		for j := h; j != nil; j = j.Jump {
+			addAuth(j.Auth)
+		}
+	}
+	for _, d := range c.Discoveries {
+		addAuth(d.Auth)
+	}
+	if c.Settings.HTTP != nil {
+		for _, client := range c.Settings.HTTP.Clients {
+			add(client.Token)
+		}
+		add(c.Settings.HTTP.SigningSecret)
+	}
+	return secrets
+}
+
+// OnSecretResolved sets the function called with each secret newly resolved by a reference,
+// like a vault password read on first connection to the host
+func (c *Config) OnSecretResolved(f func(secret string)) {
+	if c.secrets != nil {
+		c.secrets.OnResolve(f)
+	}
+}
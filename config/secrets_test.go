@@ -0,0 +1,200 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bb8bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secretFile := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("BB8BOT_TEST_SECRET", "env-secret")
+	defer os.Unsetenv("BB8BOT_TEST_SECRET")
+
+	tests := []struct {
+		value  string
+		file   string
+		secret string
+		err    string
+	}{
+		{"plain", "", "plain", ""},
+		{"${BB8BOT_TEST_SECRET}", "", "env-secret", ""},
+		{"prefix-${BB8BOT_TEST_SECRET}-$HOME", "", "prefix-env-secret-$HOME", ""},
+		{"${BB8BOT_TEST_NOT_SET}", "", "", `password: environment variable "BB8BOT_TEST_NOT_SET" is not set`},
+		{"", secretFile, "file-secret", ""},
+		{"plain", secretFile, "", "password: both value and file are set"},
+		{"", filepath.Join(dir, "not-exist"), "", "password: open " + filepath.Join(dir, "not-exist") + ": no such file or directory"},
+	}
+
+	for i, test := range tests {
+		secret, err := resolveSecret("password", test.value, test.file)
+		var e string
+		if err != nil {
+			e = err.Error()
+		}
+		if e != test.err {
+			t.Errorf("%d: Got err: %q, want: %q", i, e, test.err)
+		}
+		if secret != test.secret {
+			t.Errorf("%d: Got secret: %q, want: %q", i, secret, test.secret)
+		}
+	}
+}
+
+type testSecretProvider struct {
+	reads  int
+	data   map[string]string
+	ttl    time.Duration
+	onRead func()
+}
+
+func (p *testSecretProvider) ReadSecret(path string) (map[string]string, time.Duration, error) {
+	p.reads++
+	if p.onRead != nil {
+		p.onRead()
+	}
+	if path != "secret/data/ssh" {
+		return nil, 0, errors.New("not found")
+	}
+	return p.data, p.ttl, nil
+}
+
+func TestSecretResolver(t *testing.T) {
+	provider := &testSecretProvider{data: map[string]string{"password": "v1"}, ttl: time.Minute}
+	resolver := NewSecretResolver(map[string]SecretProvider{"vault": provider}, 5*time.Minute)
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+
+	tests := []struct {
+		value  string
+		secret string
+		err    string
+	}{
+		{"plain", "plain", ""},
+		{"other:secret/data/ssh#password", "other:secret/data/ssh#password", ""},
+		{"vault:secret/data/ssh#password", "v1", ""},
+		{"vault:secret/data/ssh#username", "", `secret "vault:secret/data/ssh" doesn't contain key "username"`},
+		{"vault:secret/data/other#password", "", `error reading secret "vault:secret/data/other": not found`},
+	}
+	for i, test := range tests {
+		secret, err := resolver.Resolve(test.value)
+		var e string
+		if err != nil {
+			e = err.Error()
+		}
+		if e != test.err {
+			t.Errorf("%d: Got err: %q, want: %q", i, e, test.err)
+		}
+		if secret != test.secret {
+			t.Errorf("%d: Got secret: %q, want: %q", i, secret, test.secret)
+		}
+	}
+
+	ref := "vault:secret/data/ssh#password"
+	reads := provider.reads
+	provider.data = map[string]string{"password": "v2"}
+	if secret, _ := resolver.Resolve(ref); secret != "v1" || provider.reads != reads {
+		t.Errorf("Got secret: %q with %d reads, want cached one", secret, provider.reads-reads)
+	}
+	now = now.Add(time.Minute)
+	if secret, _ := resolver.Resolve(ref); secret != "v2" || provider.reads != reads+1 {
+		t.Errorf("Got secret: %q with %d reads after lease expiration", secret, provider.reads-reads)
+	}
+	provider.data = map[string]string{"password": "v3"}
+	resolver.Refresh(ref)
+	if secret, _ := resolver.Resolve(ref); secret != "v3" {
+		t.Errorf("Got secret: %q after refresh, want: %q", secret, "v3")
+	}
+	if resolved := resolver.Resolved(); !reflect.DeepEqual(resolved, []string{"v1", "v2", "v3"}) {
+		t.Errorf("Got resolved secrets: %q", resolved)
+	}
+
+	// the provider is read without the lock, so the resolver is usable meanwhile
+	var notified []string
+	resolver.OnResolve(func(secret string) {
+		notified = append(notified, secret)
+	})
+	provider.data = map[string]string{"password": "v4"}
+	provider.onRead = func() {
+		resolver.Refresh("vault:secret/data/other#password")
+	}
+	resolver.Refresh(ref)
+	done := make(chan struct{})
+	go func() {
+		resolver.Resolve(ref)
+		resolver.Resolve(ref)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Resolve holds the lock while reading the provider")
+	}
+	if !reflect.DeepEqual(notified, []string{"v4"}) {
+		t.Errorf("Got notified secrets: %q, want: %q", notified, []string{"v4"})
+	}
+
+	if err := resolver.validateReference("password", "vault:secret/data/ssh"); err == nil {
+		t.Error("Got no error for reference without key")
+	}
+	if err := (*SecretResolver)(nil).validateReference("password", ref); err == nil {
+		t.Error("Got no error for reference without vault")
+	}
+}
+
+func TestConfigSecrets(t *testing.T) {
+	conf, err := Parse(`
+[settings]
+    token = "xoxb-token"
+    [settings.vault]
+        address = "http://vault:8200"
+        token = "vault-token"
+    [settings.http]
+        listen = ":8080"
+        signingSecret = "signing-secret"
+        [[settings.http.client]]
+            id = "ci"
+            token = "api-token"
+
+[[host]]
+    id = "onehost"
+    [host.auth]
+        type = "password"
+        password = "host-password"
+
+[[host]]
+    id = "twohost"
+    [host.auth]
+        type = "publickey"
+        privateKeyPath = "/key"
+        passphrase = "vault:secret/data/ssh#passphrase"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := make(map[string]struct{})
+	for _, s := range conf.Secrets() {
+		secrets[s] = struct{}{}
+	}
+	for _, want := range []string{"xoxb-token", "vault-token", "api-token", "signing-secret", "host-password"} {
+		if _, exist := secrets[want]; !exist {
+			t.Errorf("Secret %q not found in %v", want, secrets)
+		}
+	}
+	if _, exist := secrets["vault:secret/data/ssh#passphrase"]; exist {
+		t.Errorf("Got secret reference in secrets")
+	}
+}
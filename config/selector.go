@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Selector is the host tags expression like "prod && (web || db) && !eu"
+type Selector struct {
+	Expr string
+	root selectorNode
+}
+
+// ParseSelector parses the tags expression with &&, ||, ! operators and parentheses
+func ParseSelector(expr string) (*Selector, error) {
+	p := &selectorParser{tokens: tokenizeSelector(expr)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty tags expression")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("bad tags expression %q: %v", expr, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("bad tags expression %q: unexpected %q", expr, p.tokens[p.pos])
+	}
+	return &Selector{Expr: expr, root: root}, nil
+}
+
+// Match reports whether the host tags satisfy the expression
+func (s *Selector) Match(h *Host) bool {
+	tags := make(map[string]struct{}, len(h.Tags))
+	for _, t := range h.Tags {
+		tags[t] = struct{}{}
+	}
+	return s.root.eval(tags)
+}
+
+// Select returns hosts matching the expression sorted by id
+func (s *Selector) Select(hosts map[string]*Host) []*Host {
+	var selected []*Host
+	for _, h := range hosts {
+		if s.Match(h) {
+			selected = append(selected, h)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Id < selected[j].Id
+	})
+	return selected
+}
+
+type selectorNode interface {
+	eval(tags map[string]struct{}) bool
+}
+
+type tagNode string
+
+func (n tagNode) eval(tags map[string]struct{}) bool {
+	_, exist := tags[string(n)]
+	return exist
+}
+
+type notNode struct {
+	node selectorNode
+}
+
+func (n notNode) eval(tags map[string]struct{}) bool {
+	return !n.node.eval(tags)
+}
+
+type andNode struct {
+	left, right selectorNode
+}
+
+func (n andNode) eval(tags map[string]struct{}) bool {
+	return n.left.eval(tags) && n.right.eval(tags)
+}
+
+type orNode struct {
+	left, right selectorNode
+}
+
+func (n orNode) eval(tags map[string]struct{}) bool {
+	return n.left.eval(tags) || n.right.eval(tags)
+}
+
+// tokenizeSelector splits the expression into operators, parentheses and tags
+func tokenizeSelector(expr string) []string {
+	var tokens []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == '!':
+			tokens = append(tokens, string(r))
+			i++
+		case (r == '&' || r == '|') && i+1 < len(runes) && runes[i+1] == r:
+			tokens = append(tokens, string(runes[i:i+2]))
+			i += 2
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("()!&|", runes[i]) {
+				i++
+			}
+			if start == i {
+				// single & or |
+				tokens = append(tokens, string(r))
+				i++
+			} else {
+				tokens = append(tokens, string(runes[start:i]))
+			}
+		}
+	}
+	return tokens
+}
+
+// selectorParser is the recursive descent parser: or = and {"||" and}, and = unary {"&&" unary},
+// unary = "!" unary | "(" or ")" | tag
+type selectorParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *selectorParser) next() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *selectorParser) parseOr() (selectorNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *selectorParser) parseAnd() (selectorNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "&&" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *selectorParser) parseUnary() (selectorNode, error) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "!":
+		p.pos++
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	case "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return node, nil
+	case ")", "&&", "||", "&", "|":
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+	p.pos++
+	return tagNode(token), nil
+}
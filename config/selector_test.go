@@ -0,0 +1,100 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestSelector(t *testing.T) {
+	host := &Host{Id: "web1", Tags: []string{"prod", "web", "eu"}}
+
+	tests := []struct {
+		expr  string
+		match bool
+		err   string
+	}{
+		{"prod", true, ""},
+		{"db", false, ""},
+		{"prod && web", true, ""},
+		{"prod && db", false, ""},
+		{"db || web", true, ""},
+		{"!db", true, ""},
+		{"prod && !(eu || us)", false, ""},
+		{"(db || web) && eu", true, ""},
+		{"!prod || db", false, ""},
+		{"", false, "empty tags expression"},
+		{"prod &&", false, `bad tags expression "prod &&": unexpected end of expression`},
+		{"(prod", false, `bad tags expression "(prod": missing closing parenthesis`},
+		{"prod web", false, `bad tags expression "prod web": unexpected "web"`},
+		{"prod & web", false, `bad tags expression "prod & web": unexpected "&"`},
+	}
+
+	for i, test := range tests {
+		s, err := ParseSelector(test.expr)
+		var e string
+		if err != nil {
+			e = err.Error()
+		}
+		if e != test.err {
+			t.Errorf("%d: Got err: %q, want: %q", i, e, test.err)
+			continue
+		}
+		if s != nil && s.Match(host) != test.match {
+			t.Errorf("%d: Got match: %v, want: %v", i, !test.match, test.match)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	conf, err := Parse(`
+[[group]]
+    id = "web"
+    hosts = ["db1"]
+    tags = "prod && web"
+    [[group.command]]
+        id = "eu-only"
+        cmdFmt = "eu-only"
+        tags = "eu"
+
+[[host]]
+    id = "web1"
+    tags = ["prod", "web", "eu"]
+    [host.auth]
+        type = "password"
+
+[[host]]
+    id = "web2"
+    tags = ["prod", "web", "us"]
+    [host.auth]
+        type = "password"
+
+[[host]]
+    id = "web3"
+    tags = ["stage", "web"]
+    [host.auth]
+        type = "password"
+
+[[host]]
+    id = "db1"
+    tags = ["prod", "db"]
+    [host.auth]
+        type = "password"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := conf.Groups["web"]
+	if len(group.Hosts) != 3 || group.Hosts["db1"] == nil || group.Hosts["web1"] == nil || group.Hosts["web2"] == nil {
+		t.Errorf("Got group hosts: %v", group.Hosts)
+	}
+	if group.Help != "\n_*Hosts:*_ `db1` `web1` `web2`\n_*Commands:*_\n`eu-only`   __" {
+		t.Errorf("Got group help: %q", group.Help)
+	}
+	command := group.Commands["eu-only"]
+	if !command.Allowed(conf.Hosts["web1"]) || command.Allowed(conf.Hosts["web2"]) {
+		t.Errorf("Got wrong command hosts restriction")
+	}
+
+	if _, err := Parse("[[group]]\n    id = \"web\"\n    tags = \"prod &&\""); err == nil {
+		t.Errorf("Got no error for bad group tags expression")
+	}
+}
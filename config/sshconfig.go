@@ -0,0 +1,329 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultSSHConfig is the OpenSSH user config path
+const defaultSSHConfig = "~/.ssh/config"
+
+// sshConfig is the parsed OpenSSH client config
+type sshConfig struct {
+	path   string
+	blocks []*sshConfigBlock
+}
+
+// sshConfigBlock is the "Host" block with its patterns and options
+type sshConfigBlock struct {
+	patterns []string
+	options  map[string]string
+}
+
+// sshConfigEntry is the host options resolved from the ssh config
+type sshConfigEntry struct {
+	alias        string
+	hostName     string
+	port         int
+	user         string
+	identityFile string
+	proxyJump    string
+}
+
+// parseSSHConfigFile reads and parses the OpenSSH client config file
+func parseSSHConfigFile(path string) (*sshConfig, error) {
+	if path == "" {
+		path = defaultSSHConfig
+	}
+	path = expandHome(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := parseSSHConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	c.path = path
+	return c, nil
+}
+
+// parseSSHConfig parses the OpenSSH client config.
+// Options before the first "Host" are applied to all hosts, "Match" blocks are skipped.
+func parseSSHConfig(r io.Reader) (*sshConfig, error) {
+	c := &sshConfig{}
+	block := &sshConfigBlock{patterns: []string{"*"}, options: make(map[string]string)}
+	c.blocks = append(c.blocks, block)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value := splitSSHConfigLine(text)
+		if value == "" {
+			return nil, fmt.Errorf("line %d: option %q without value", line, key)
+		}
+		switch key {
+		case "host":
+			block = &sshConfigBlock{patterns: strings.Fields(value), options: make(map[string]string)}
+			c.blocks = append(c.blocks, block)
+		case "match":
+			block = &sshConfigBlock{options: make(map[string]string)}
+			c.blocks = append(c.blocks, block)
+		default:
+			// the first obtained value is used
+			if _, exist := block.options[key]; !exist {
+				block.options[key] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// splitSSHConfigLine splits the "Key value" or "Key=value" line into the lower case key and value
+func splitSSHConfigLine(text string) (string, string) {
+	i := strings.IndexAny(text, " \t=")
+	if i == -1 {
+		return strings.ToLower(text), ""
+	}
+	key := strings.ToLower(text[:i])
+	value := strings.TrimSpace(text[i:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+	return key, value
+}
+
+// lookup resolves options for the host alias with the OpenSSH semantics:
+// blocks are matched in order and the first obtained value of each option is used
+func (c *sshConfig) lookup(alias string) (*sshConfigEntry, error) {
+	options := make(map[string]string)
+	for _, b := range c.blocks {
+		if !b.matches(alias) {
+			continue
+		}
+		for k, v := range b.options {
+			if _, exist := options[k]; !exist {
+				options[k] = v
+			}
+		}
+	}
+	entry := &sshConfigEntry{
+		alias:        alias,
+		hostName:     alias,
+		port:         22,
+		user:         options["user"],
+		identityFile: options["identityfile"],
+		proxyJump:    options["proxyjump"],
+	}
+	if hostName := options["hostname"]; hostName != "" {
+		entry.hostName = strings.Replace(hostName, "%h", alias, -1)
+	}
+	if port := options["port"]; port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("ssh config host %q: bad port %q", alias, port)
+		}
+		entry.port = p
+	}
+	if entry.identityFile != "" {
+		entry.identityFile = expandHome(entry.identityFile)
+	}
+	if entry.proxyJump == "none" {
+		entry.proxyJump = ""
+	}
+	return entry, nil
+}
+
+// aliases returns all host aliases from the config without wildcards and negations
+func (c *sshConfig) aliases() []string {
+	var aliases []string
+	seen := make(map[string]struct{})
+	for _, b := range c.blocks {
+		for _, p := range b.patterns {
+			if strings.ContainsAny(p, "*?!") {
+				continue
+			}
+			if _, exist := seen[p]; !exist {
+				seen[p] = struct{}{}
+				aliases = append(aliases, p)
+			}
+		}
+	}
+	return aliases
+}
+
+// matches reports whether the alias matches any block pattern and none of the negated ones
+func (b *sshConfigBlock) matches(alias string) bool {
+	matched := false
+	for _, p := range b.patterns {
+		if strings.HasPrefix(p, "!") {
+			if ok, _ := filepath.Match(p[1:], alias); ok {
+				return false
+			}
+		} else if ok, _ := filepath.Match(p, alias); ok {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// applySSHConfig fills the host fields that are not set in the bot config from the ssh config entry
+func applySSHConfig(h *host, entry *sshConfigEntry) {
+	if h.Address == "" {
+		h.Address = entry.hostName
+	}
+	if h.Port == 0 {
+		h.Port = entry.port
+	}
+	if h.Auth.Username == "" {
+		h.Auth.Username = entry.user
+	}
+	if h.Auth.Type == "" {
+		h.Auth.Type = "publickey"
+	}
+	if h.Auth.Type == "publickey" && h.Auth.PrivateKeyPath == "" {
+		h.Auth.PrivateKeyPath = entry.identityFile
+		if h.Auth.PrivateKeyPath == "" {
+			h.Auth.PrivateKeyPath = expandHome("~/.ssh/id_rsa")
+		}
+	}
+	if h.Auth.Username == "" {
+		h.Auth.Username = os.Getenv("USER")
+	}
+	h.proxyJump = entry.proxyJump
+}
+
+// jumpHost returns the jump hosts chain for the ProxyJump value.
+// Jump hosts without their own identity file use the target host authentication.
+func (c *sshConfig) jumpHost(proxyJump string, target *Auth) (*Host, error) {
+	var jump *Host
+	for _, spec := range strings.Split(proxyJump, ",") {
+		spec = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(spec), "ssh://"))
+		user := ""
+		if i := strings.LastIndex(spec, "@"); i != -1 {
+			user = spec[:i]
+			spec = spec[i+1:]
+		}
+		alias := spec
+		port := 0
+		if i := strings.LastIndex(spec, ":"); i != -1 {
+			p, err := strconv.Atoi(spec[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("bad ProxyJump %q", proxyJump)
+			}
+			alias = spec[:i]
+			port = p
+		}
+		entry, err := c.lookup(alias)
+		if err != nil {
+			return nil, err
+		}
+		if port == 0 {
+			port = entry.port
+		}
+		if user == "" {
+			user = entry.user
+		}
+		if user == "" {
+			user = target.Username
+		}
+		auth := &Auth{
+			Type:           target.Type,
+			Username:       user,
+			Password:       target.Password,
+			PrivateKeyPath: target.PrivateKeyPath,
+			Passphrase:     target.Passphrase,
+			secrets:        target.secrets,
+		}
+		if entry.identityFile != "" {
+			auth = &Auth{
+				Type:           "publickey",
+				Username:       user,
+				PrivateKeyPath: entry.identityFile,
+			}
+		}
+		// each next jump host is dialed through the previous one
+		jump = &Host{
+			Id:      alias,
+			Address: entry.hostName,
+			Port:    port,
+			Auth:    auth,
+			Jump:    jump,
+		}
+	}
+	return jump, nil
+}
+
+// expandHome replaces the leading "~" with the user home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// importSSHConfig fills hosts that reference ssh config hosts and adds all ssh config hosts if import is enabled.
+// It returns the parsed ssh config or nil if it is not used.
+func importSSHConfig(internal *config) (*sshConfig, error) {
+	used := internal.Settings.ImportSSHConfig
+	for _, h := range internal.Hosts {
+		if h.SSHConfigHost != "" {
+			used = true
+		}
+	}
+	if !used {
+		return nil, nil
+	}
+	c, err := parseSSHConfigFile(internal.Settings.SSHConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]struct{})
+	for i := range internal.Hosts {
+		h := &internal.Hosts[i]
+		if h.SSHConfigHost != "" {
+			entry, err := c.lookup(h.SSHConfigHost)
+			if err != nil {
+				return nil, err
+			}
+			if h.Id == "" {
+				h.Id = h.SSHConfigHost
+			}
+			applySSHConfig(h, entry)
+		}
+		ids[h.Id] = struct{}{}
+	}
+
+	if internal.Settings.ImportSSHConfig {
+		// hosts from the bot config take precedence over the imported ones
+		for _, alias := range c.aliases() {
+			if _, exist := ids[alias]; exist {
+				continue
+			}
+			entry, err := c.lookup(alias)
+			if err != nil {
+				return nil, err
+			}
+			h := host{Id: alias, source: c.path}
+			applySSHConfig(&h, entry)
+			internal.Hosts = append(internal.Hosts, h)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testSSHConfig = `
+# global options
+ServerAliveInterval 30
+
+Host prod-web-*
+    User deploy
+    IdentityFile /keys/prod
+    ProxyJump bastion
+
+Host prod-web-1
+    HostName 10.0.0.1
+    User other
+
+Host bastion
+    HostName bastion.example.com
+    Port=2222
+    User jump
+    IdentityFile "/keys/bastion"
+
+Host * !bastion
+    Port 22022
+
+Match host other
+    User matched
+`
+
+func TestSSHConfigLookup(t *testing.T) {
+	c, err := parseSSHConfig(strings.NewReader(testSSHConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		alias string
+		entry *sshConfigEntry
+	}{
+		{
+			"prod-web-1",
+			&sshConfigEntry{alias: "prod-web-1", hostName: "10.0.0.1", port: 22022, user: "deploy", identityFile: "/keys/prod", proxyJump: "bastion"},
+		},
+		{
+			"prod-web-2",
+			&sshConfigEntry{alias: "prod-web-2", hostName: "prod-web-2", port: 22022, user: "deploy", identityFile: "/keys/prod", proxyJump: "bastion"},
+		},
+		{
+			"bastion",
+			&sshConfigEntry{alias: "bastion", hostName: "bastion.example.com", port: 2222, user: "jump", identityFile: "/keys/bastion"},
+		},
+		{
+			"other",
+			&sshConfigEntry{alias: "other", hostName: "other", port: 22022},
+		},
+	}
+	for i, test := range tests {
+		entry, err := c.lookup(test.alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(entry, test.entry) {
+			t.Errorf("%d: Got entry: %+v, want: %+v", i, entry, test.entry)
+		}
+	}
+
+	if aliases := c.aliases(); !reflect.DeepEqual(aliases, []string{"prod-web-1", "bastion"}) {
+		t.Errorf("Got aliases: %q", aliases)
+	}
+}
+
+func TestParseSSHConfigHosts(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"ssh_config": testSSHConfig})
+	defer os.RemoveAll(dir)
+
+	conf, err := Parse(`
+[settings]
+    sshConfig = "` + filepath.Join(dir, "ssh_config") + `"
+    importSshConfig = true
+
+[[host]]
+    id = "web"
+    sshConfigHost = "prod-web-2"
+
+[[host]]
+    sshConfigHost = "prod-web-1"
+    [host.auth]
+        type = "password"
+        password = "gayjke"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bastion := &Host{
+		Id:      "bastion",
+		Address: "bastion.example.com",
+		Port:    2222,
+		Auth:    &Auth{Type: "publickey", Username: "jump", PrivateKeyPath: "/keys/bastion"},
+	}
+	expected := map[string]*Host{
+		"web": {
+			Id:      "web",
+			Address: "prod-web-2",
+			Port:    22022,
+			Auth:    &Auth{Type: "publickey", Username: "deploy", PrivateKeyPath: "/keys/prod"},
+			Jump:    bastion,
+		},
+		"prod-web-1": {
+			Id:      "prod-web-1",
+			Address: "10.0.0.1",
+			Port:    22022,
+			Auth:    &Auth{Type: "password", Username: "deploy", Password: "gayjke"},
+			Jump:    bastion,
+		},
+		"bastion": bastion,
+	}
+	if !reflect.DeepEqual(conf.Hosts, expected) {
+		for id, h := range conf.Hosts {
+			t.Logf("%s: %+v %+v", id, h, h.Auth)
+		}
+		t.Fatalf("Got unexpected hosts")
+	}
+}
+
+func TestParseFileSSHConfigHosts(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"ssh_config": testSSHConfig})
+	defer os.RemoveAll(dir)
+	hosts := "[[host]]\n    sshConfigHost = \"prod-web-1\"\n[[host]]\n    sshConfigHost = \"prod-web-2\"\n"
+	config := "[settings]\n    sshConfig = \"" + filepath.Join(dir, "ssh_config") + "\"\n" + hosts
+
+	tests := []struct {
+		hosts string
+		err   string
+	}{
+		{"", ""},
+		{"[[host]]\n    id = \"prod-web-1\"\n    address = \"10.0.0.2\"\n", `duplicate host id "prod-web-1"`},
+	}
+	for i, test := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("config%d.toml", i))
+		if err := ioutil.WriteFile(path, []byte(config+test.hosts), 0600); err != nil {
+			t.Fatal(err)
+		}
+		conf, err := ParseFile(path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%d: Got err: %v, want: %v", i, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: Got err: %v", i, err)
+			continue
+		}
+		for _, id := range []string{"prod-web-1", "prod-web-2"} {
+			if _, exist := conf.Hosts[id]; !exist {
+				t.Errorf("%d: Host %q not found", i, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultVaultTTL is the cache duration for secrets without lease like KV v2 ones
+const defaultVaultTTL = 5 * time.Minute
+
+// VaultProvider reads secrets from the HashiCorp Vault compatible HTTP API.
+// It supports KV v2 (secret/data/...) and KV v1 secret engines.
+type VaultProvider struct {
+	Address   string
+	Token     string
+	Namespace string
+	Client    *http.Client
+}
+
+// ReadSecret reads the secret by path and returns its data with the lease duration
+func (p *VaultProvider) ReadSecret(path string) (map[string]string, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(p.Address, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("vault responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		LeaseDuration int                    `json:"lease_duration"`
+		Data          map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, 0, fmt.Errorf("error parsing vault response: %v", err)
+	}
+	values := secret.Data
+	// KV v2 wraps the secret values with metadata
+	if nested, ok := values["data"].(map[string]interface{}); ok {
+		if _, ok := values["metadata"]; ok {
+			values = nested
+		}
+	}
+	data := make(map[string]string, len(values))
+	for k, v := range values {
+		if s, ok := v.(string); ok {
+			data[k] = s
+		} else {
+			data[k] = fmt.Sprint(v)
+		}
+	}
+	return data, time.Duration(secret.LeaseDuration) * time.Second, nil
+}
+
+// newVaultResolver returns the secret resolver with the vault provider or nil if vault is not configured
+func newVaultResolver(v vault) (*SecretResolver, error) {
+	if v.Address == "" {
+		return nil, nil
+	}
+	address, err := interpolate(v.Address)
+	if err != nil {
+		return nil, fmt.Errorf("vault address: %v", err)
+	}
+	token, err := resolveSecret("vault token", v.Token, v.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	ttl := defaultVaultTTL
+	if v.TTL != "" {
+		ttl, err = time.ParseDuration(v.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("vault ttl: %v", err)
+		}
+	}
+	provider := &VaultProvider{
+		Address:   address,
+		Token:     token,
+		Namespace: v.Namespace,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	return NewSecretResolver(map[string]SecretProvider{vaultScheme: provider}, ttl), nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/ssh":
+			w.Write([]byte(`{"lease_duration":0,"data":{"data":{"password":"kv2-pass"},"metadata":{"version":3}}}`))
+		case "/v1/kv/ssh":
+			w.Write([]byte(`{"lease_duration":60,"data":{"password":"kv1-pass","port":22}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := &VaultProvider{Address: server.URL + "/", Token: "vault-token"}
+
+	data, ttl, err := provider.ReadSecret("secret/data/ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, map[string]string{"password": "kv2-pass"}) || ttl != 0 {
+		t.Errorf("Got KV v2 data: %v, ttl: %v", data, ttl)
+	}
+
+	data, ttl, err = provider.ReadSecret("kv/ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, map[string]string{"password": "kv1-pass", "port": "22"}) || ttl != time.Minute {
+		t.Errorf("Got KV v1 data: %v, ttl: %v", data, ttl)
+	}
+
+	if _, _, err := provider.ReadSecret("secret/data/not-exist"); err == nil || err.Error() != `vault responded with status 404: {"errors":[]}` {
+		t.Errorf("Got err: %v for not existing secret", err)
+	}
+
+	conf, err := Parse(`
+[settings.vault]
+    address = "` + server.URL + `"
+    token = "vault-token"
+
+[[host]]
+    id = "onehost"
+    [host.auth]
+        type = "password"
+        username = "shmee"
+        password = "vault:secret/data/ssh#password"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resolved []string
+	conf.OnSecretResolved(func(secret string) {
+		resolved = append(resolved, secret)
+	})
+	password, err := conf.Hosts["onehost"].Auth.ResolvePassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "kv2-pass" {
+		t.Errorf("Got password: %q, want: %q", password, "kv2-pass")
+	}
+	if !reflect.DeepEqual(resolved, []string{"kv2-pass"}) {
+		t.Errorf("Got resolved secrets: %q", resolved)
+	}
+	secrets := conf.Secrets()
+	if !reflect.DeepEqual(secrets, []string{"vault-token", "kv2-pass"}) {
+		t.Errorf("Got secrets: %q", secrets)
+	}
+}
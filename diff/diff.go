@@ -0,0 +1,200 @@
+// Package diff implements the line based unified diff.
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxChanges is the maximum number of removed and inserted lines, it bounds the diff memory by O(MaxChanges²)
+const MaxChanges = 2000
+
+// ErrTooDifferent is returned if texts differ by more than MaxChanges lines
+var ErrTooDifferent = errors.New("texts differ too much")
+
+// Unified returns the unified diff of texts with context lines around changes,
+// the empty string is returned if texts are equal
+func Unified(from, to, fromName, toName string, context int) (string, error) {
+	a, b := splitLines(from), splitLines(to)
+	ops, err := lineOps(a, b, MaxChanges)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, h := range hunks(ops, context) {
+		if out.Len() == 0 {
+			out.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName))
+		}
+		out.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(h.fromLine, h.fromCount), hunkRange(h.toLine, h.toCount)))
+		for _, op := range h.ops {
+			switch op.kind {
+			case equal:
+				out.WriteString(" " + a[op.from] + "\n")
+			case remove:
+				out.WriteString("-" + a[op.from] + "\n")
+			case insert:
+				out.WriteString("+" + b[op.to] + "\n")
+			}
+		}
+	}
+	return out.String(), nil
+}
+
+type opKind int
+
+const (
+	equal opKind = iota
+	remove
+	insert
+)
+
+// op is the edit script operation with line indexes in both texts
+type op struct {
+	kind     opKind
+	from, to int
+}
+
+type hunk struct {
+	fromLine, fromCount int
+	toLine, toCount     int
+	ops                 []op
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// lineOps returns the shortest edit script by the Myers algorithm,
+// ErrTooDifferent is returned if the script has more than maxChanges removes and inserts
+func lineOps(a, b []string, maxChanges int) ([]op, error) {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// the states of diagonals -d-1..d+1 used by backtracking, so the trace is O(d²)
+	var trace [][]int
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		if d > maxChanges {
+			return nil, ErrTooDifferent
+		}
+		snapshot := make([]int, 2*d+3)
+		copy(snapshot, v[offset-d-1:offset+d+2])
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	// backtrack from the end through the saved states
+	var ops []op
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v, offset := trace[d], d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{equal, x, y})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				ops = append(ops, op{insert, x, y})
+			} else {
+				x--
+				ops = append(ops, op{remove, x, y})
+			}
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops, nil
+}
+
+// hunks groups changes with context lines, close changes are merged into one hunk
+func hunks(ops []op, context int) []hunk {
+	var result []hunk
+	for i := 0; i < len(ops); {
+		if ops[i].kind == equal {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != equal {
+				end++
+				continue
+			}
+			// equal lines run, the hunk ends if it is longer than the context on both sides
+			run := end
+			for run < len(ops) && ops[run].kind == equal {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end += context
+				if end > run {
+					end = run
+				}
+				break
+			}
+			end = run
+		}
+		h := hunk{ops: ops[start:end], fromLine: ops[start].from + 1, toLine: ops[start].to + 1}
+		for _, o := range h.ops {
+			if o.kind != insert {
+				h.fromCount++
+			}
+			if o.kind != remove {
+				h.toCount++
+			}
+		}
+		result = append(result, h)
+		i = end
+	}
+	return result
+}
+
+// hunkRange returns the "line,count" hunk range, the line before the hunk is used for the empty range
+func hunkRange(line, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
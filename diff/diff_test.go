@@ -0,0 +1,66 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		from, to string
+		diff     string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"", "", ""},
+		{"", "a\n", "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n"},
+		{"a\n", "", "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n"},
+		{"a\nb\nc\n", "a\nx\nc\n", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "--- old\n+++ new\n@@ -8,2 +8,3 @@\n 8\n 9\n+10\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n", "--- old\n+++ new\n@@ -1,2 +1,3 @@\n+0\n 1\n 2\n"},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"1\nx\n3\n4\n5\n6\n7\n8\ny\n",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n 1\n-2\n+x\n 3\n 4\n@@ -7,3 +7,3 @@\n 7\n 8\n-9\n+y\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n",
+			"1\nx\n3\n4\ny\n",
+			"--- old\n+++ new\n@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n-5\n+y\n",
+		},
+		{"tcp ESTABLISHED\ntcp LISTEN", "tcp LISTEN", "--- old\n+++ new\n@@ -1,2 +1 @@\n-tcp ESTABLISHED\n tcp LISTEN\n"},
+	}
+	for i, test := range tests {
+		diff, err := Unified(test.from, test.to, "old", "new", 2)
+		if err != nil {
+			t.Errorf("%d: Got err: %v", i, err)
+		}
+		if diff != test.diff {
+			t.Errorf("%d: Got diff:\n%s\nwant:\n%s", i, diff, test.diff)
+		}
+	}
+}
+
+func TestUnifiedLimit(t *testing.T) {
+	lines := func(prefix string, count int) string {
+		var b strings.Builder
+		for i := 0; i < count; i++ {
+			b.WriteString(fmt.Sprintf("%s%d\n", prefix, i))
+		}
+		return b.String()
+	}
+	same := lines("same", 100000)
+	diff, err := Unified(same+lines("a", MaxChanges/2), same+lines("b", MaxChanges/2), "old", "new", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(diff, "\n"); n != 2+1+2+MaxChanges {
+		t.Errorf("Got %d diff lines, want: %d", n, 2+1+2+MaxChanges)
+	}
+	if _, err := Unified(same+lines("a", MaxChanges/2+1), same+lines("b", MaxChanges/2), "old", "new", 2); err != ErrTooDifferent {
+		t.Errorf("Got err: %v, want: %v", err, ErrTooDifferent)
+	}
+	if _, err := Unified(lines("a", 100000), lines("b", 100000), "old", "new", 2); err != ErrTooDifferent {
+		t.Errorf("Got err: %v for long different texts, want: %v", err, ErrTooDifferent)
+	}
+}
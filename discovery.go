@@ -0,0 +1,30 @@
+package main
+
+import (
+	"time"
+)
+
+// discoveryTick is the period of checking discoveries refresh intervals
+const discoveryTick = 5 * time.Second
+
+// discover periodically refreshes hosts from the config discoveries.
+// Hosts of the failed discovery are kept until the next successful refresh.
+func (s *configStore) discover() {
+	refreshed := make(map[string]time.Time)
+	for {
+		for _, d := range s.discoveries() {
+			if time.Since(refreshed[d.Id]) < d.Interval {
+				continue
+			}
+			refreshed[d.Id] = time.Now()
+			hosts, err := d.Discover()
+			if err != nil {
+				logger.Error("Error discovering hosts", "err", err)
+				continue
+			}
+			logger.Info("Hosts discovered", "discovery", d.Id, "hosts", len(hosts), "group", d.Group)
+			s.setDiscovered(d.Id, hosts)
+		}
+		time.Sleep(discoveryTick)
+	}
+}
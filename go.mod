@@ -4,9 +4,12 @@ go 1.13
 
 require (
 	github.com/BurntSushi/toml v0.3.1
+	github.com/fsnotify/fsnotify v1.5.1
 	github.com/gorilla/websocket v1.4.1 // indirect
 	github.com/nlopes/slack v0.6.1-0.20191106133607-d06c2a2b3249
-	github.com/pkg/errors v0.8.1 // indirect
-	golang.org/x/crypto v0.0.0-20191219195013-becbf705a915
-	golang.org/x/sys v0.0.0-20191220220014-0732a990476f // indirect
+	github.com/prometheus/client_golang v1.11.1
+	github.com/robfig/cron/v3 v3.0.1
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/karlovskiy/bb8bot/config"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// readyTimeout is the ssh connection timeout for readiness critical hosts
+const readyTimeout = 5 * time.Second
+
+// readyCacheTTL is the time the critical hosts check results are reused for,
+// so probes, which aren't authenticated, can't make the bot open ssh connections on each request
+const readyCacheTTL = 30 * time.Second
+
+// health serves liveness and readiness probes
+type health struct {
+	bot     *bot
+	reach   func(host *config.Host) error
+	now     func() time.Time
+	mu      sync.Mutex
+	checked map[string]hostCheck
+}
+
+// hostCheck is the cached critical host check result
+type hostCheck struct {
+	err  error
+	time time.Time
+}
+
+// readyResponse is the readiness probe response with checks results
+type readyResponse struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// newHealth returns probes checking critical hosts by opening ssh connections
+func newHealth(b *bot) *health {
+	return &health{bot: b, reach: reachHost, now: time.Now, checked: make(map[string]hostCheck)}
+}
+
+// register adds probes routes to the mux
+func (h *health) register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+}
+
+// handleHealthz reports that the process is alive
+func (h *health) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether chat is connected, config is loaded and critical hosts are reachable
+func (h *health) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	resp := readyResponse{Ready: true, Checks: make(map[string]string)}
+	fail := func(check, msg string) {
+		resp.Ready = false
+		resp.Checks[check] = msg
+	}
+
+	if h.bot.isConnected() {
+		resp.Checks["slack"] = "ok"
+	} else {
+		fail("slack", "not connected")
+	}
+	conf := h.bot.store.Load()
+	if conf == nil {
+		fail("config", "not loaded")
+		writeJSON(w, http.StatusServiceUnavailable, &resp)
+		return
+	}
+	resp.Checks["config"] = "ok"
+
+	if conf.Settings.HTTP != nil {
+		var hosts []*config.Host
+		for _, id := range conf.Settings.HTTP.ReadyHosts {
+			host, exist := conf.Hosts[id]
+			if !exist {
+				fail("host "+id, "not found")
+				continue
+			}
+			hosts = append(hosts, host)
+		}
+		for id, err := range h.checkHosts(hosts) {
+			if err != nil {
+				fail("host "+id, err.Error())
+			} else {
+				resp.Checks["host "+id] = "ok"
+			}
+		}
+	}
+
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, &resp)
+}
+
+// checkHosts returns the errors of opening ssh connections to the hosts by ids.
+// Results are cached for readyCacheTTL and concurrent probes wait for one check.
+func (h *health) checkHosts(hosts []*config.Host) map[string]error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		if c, exist := h.checked[host.Id]; exist && now.Sub(c.time) < readyCacheTTL {
+			continue
+		}
+		wg.Add(1)
+		go func(host *config.Host) {
+			defer wg.Done()
+			err := h.reach(host)
+			mu.Lock()
+			defer mu.Unlock()
+			h.checked[host.Id] = hostCheck{err: err, time: now}
+		}(host)
+	}
+	wg.Wait()
+	errs := make(map[string]error, len(hosts))
+	for _, host := range hosts {
+		errs[host.Id] = h.checked[host.Id].err
+	}
+	return errs
+}
+
+// reachHost opens and closes the ssh connection to the host
+func reachHost(host *config.Host) error {
+	client, err := dial(host, readyTimeout)
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+// setConnected stores the chat connection state
+func (b *bot) setConnected(connected bool) {
+	var v int32
+	if connected {
+		v = 1
+	}
+	atomic.StoreInt32(&b.connected, v)
+}
+
+// isConnected reports whether the chat connection is established
+func (b *bot) isConnected() bool {
+	return atomic.LoadInt32(&b.connected) == 1
+}
+
+// healthcheck requests the readiness probe of the running bot, it is used by Docker HEALTHCHECK.
+// The check passes if the HTTP server is disabled, so configs without it keep containers healthy.
+func healthcheck(conf *config.Config) error {
+	if conf.Settings.HTTP == nil {
+		logger.Info("Healthcheck skipped, http listen address is not set")
+		return nil
+	}
+	host, port, err := net.SplitHostPort(conf.Settings.HTTP.Listen)
+	if err != nil {
+		return err
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	client := &http.Client{Timeout: 2 * readyTimeout}
+	resp, err := client.Get(fmt.Sprintf("http://%s/readyz", net.JoinHostPort(host, port)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("not ready, status: %d", resp.StatusCode))
+	}
+	return nil
+}
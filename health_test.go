@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"github.com/karlovskiy/bb8bot/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	conf := makeTestConfig()
+	conf.Settings.HTTP = &config.HTTP{Listen: ":8080", ReadyHosts: []string{"onehost"}}
+	store := &configStore{}
+	store.current.Store(conf)
+	b := &bot{store: store}
+	h := newHealth(b)
+	now := time.Now()
+	h.now = func() time.Time { return now }
+	mux := http.NewServeMux()
+	h.register(mux)
+
+	tests := []struct {
+		path      string
+		connected bool
+		reach     error
+		status    int
+		resp      string
+	}{
+		{"/healthz", false, nil, 200, `{"status":"ok"}`},
+		{"/readyz", false, nil, 503, `{"ready":false,"checks":{"config":"ok","host onehost":"ok","slack":"not connected"}}`},
+		{"/readyz", true, errors.New("error opening ssh connection: timeout"), 503, `{"ready":false,"checks":{"config":"ok","host onehost":"error opening ssh connection: timeout","slack":"ok"}}`},
+		{"/readyz", true, nil, 200, `{"ready":true,"checks":{"config":"ok","host onehost":"ok","slack":"ok"}}`},
+	}
+	for i, test := range tests {
+		b.setConnected(test.connected)
+		h.reach = func(host *config.Host) error {
+			return test.reach
+		}
+		now = now.Add(readyCacheTTL)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%d: Got status: %d, want: %d", i, w.Code, test.status)
+		}
+		if resp := strings.TrimSpace(w.Body.String()); resp != test.resp {
+			t.Errorf("%d: Got response: %s, want: %s", i, resp, test.resp)
+		}
+	}
+
+	reached := 0
+	h.reach = func(host *config.Host) error {
+		reached++
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/readyz", nil))
+	}
+	if reached != 0 {
+		t.Errorf("Got %d ssh checks of cached results", reached)
+	}
+	now = now.Add(readyCacheTTL)
+	for i := 0; i < 3; i++ {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/readyz", nil))
+	}
+	if reached != 1 {
+		t.Errorf("Got %d ssh checks of expired results, want: 1", reached)
+	}
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	listen := strings.TrimPrefix(server.URL, "http://")
+	if err := healthcheck(&config.Config{Settings: &config.Settings{HTTP: &config.HTTP{Listen: listen}}}); err != nil {
+		t.Errorf("Got healthcheck error: %v", err)
+	}
+	b.setConnected(false)
+	if err := healthcheck(&config.Config{Settings: &config.Settings{HTTP: &config.HTTP{Listen: listen}}}); err == nil || err.Error() != "not ready, status: 503" {
+		t.Errorf("Got healthcheck error: %v", err)
+	}
+	if err := healthcheck(&config.Config{Settings: &config.Settings{}}); err != nil {
+		t.Errorf("Got healthcheck error: %v", err)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/karlovskiy/bb8bot/diff"
+	"github.com/karlovskiy/bb8bot/redact"
+	bolt "go.etcd.io/bbolt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHistoryList is the number of executions listed by the history command
+const defaultHistoryList = 10
+
+// diffContext is the number of unchanged lines around changes in diffs
+const diffContext = 3
+
+var executionsBucket = []byte("executions")
+
+// history stores chat actions executions in the bolt database
+type history struct {
+	db    *bolt.DB
+	limit int
+}
+
+// execution is the stored chat action execution
+type execution struct {
+	Id      uint64       `json:"id"`
+	Time    time.Time    `json:"time"`
+	User    string       `json:"user"`
+	Client  string       `json:"client,omitempty"`
+	Channel string       `json:"channel"`
+	Text    string       `json:"text"`
+	Group   string       `json:"group"`
+	Command string       `json:"command"`
+	Results []execResult `json:"results"`
+}
+
+// execResult is the command execution result on the host with the full output
+type execResult struct {
+	Host       string `json:"host"`
+	Cmd        string `json:"cmd"`
+	Output     string `json:"output"`
+	ExitCode   int    `json:"exitCode"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// openHistory opens or creates the history database keeping the limit of last executions
+func openHistory(settings *config.History) (*history, error) {
+	db, err := bolt.Open(settings.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening history %q: %v", settings.Path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(executionsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening history %q: %v", settings.Path, err)
+	}
+	return &history{db: db, limit: settings.Limit}, nil
+}
+
+// close closes the history database
+func (h *history) close() error {
+	return h.db.Close()
+}
+
+// add stores the execution with the next id and drops executions over the limit
+func (h *history) add(e *execution) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(executionsBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.Id = id
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(itob(id), data); err != nil {
+			return err
+		}
+		if id <= uint64(h.limit) {
+			return nil
+		}
+		var expired [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) <= id-uint64(h.limit); k, _ = c.Next() {
+			expired = append(expired, k)
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// get returns the execution by id or nil if it doesn't exist
+func (h *history) get(id uint64) (*execution, error) {
+	var e *execution
+	err := h.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(executionsBucket).Get(itob(id))
+		if data == nil {
+			return nil
+		}
+		e = &execution{}
+		return json.Unmarshal(data, e)
+	})
+	return e, err
+}
+
+// last returns up to n last executions matching the filter, the newest first
+func (h *history) last(n int, match func(e *execution) bool) ([]*execution, error) {
+	var executions []*execution
+	err := h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(executionsBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(executions) < n; k, v = c.Prev() {
+			e := &execution{}
+			if err := json.Unmarshal(v, e); err != nil {
+				return err
+			}
+			if match(e) {
+				executions = append(executions, e)
+			}
+		}
+		return nil
+	})
+	return executions, err
+}
+
+// itob returns the big endian key, so executions are sorted by id
+func itob(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
+
+// historyCommand handles history chat commands: history [n], show <id>, rerun <id>, diff <id> and !!
+func (b *bot) historyCommand(req *chatRequest, fields []string, conf *config.Config, reply replyFunc) {
+	if b.history == nil {
+		reply("History is disabled")
+		return
+	}
+	switch fields[0] {
+	case "history":
+		n := defaultHistoryList
+		if len(fields) > 1 {
+			var err error
+			if n, err = strconv.Atoi(fields[1]); err != nil || n <= 0 {
+				reply(historyHelp)
+				return
+			}
+		}
+		executions, err := b.history.last(n, func(e *execution) bool {
+			return e.Channel == req.channel
+		})
+		if err != nil {
+			reply(fmt.Sprintf("error reading history: %v", err))
+			return
+		}
+		reply(historyList(executions))
+	case "show", "rerun", "diff":
+		if len(fields) != 2 {
+			reply(historyHelp)
+			return
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "#"), 10, 64)
+		if err != nil {
+			reply(historyHelp)
+			return
+		}
+		e, err := b.history.get(id)
+		if err != nil {
+			reply(fmt.Sprintf("error reading history: %v", err))
+			return
+		}
+		// executions of other channels could be restricted, so only admins can access them
+		if e == nil || e.Channel != req.channel && !req.isAdmin {
+			reply(fmt.Sprintf("execution *#%d* not found", id))
+			return
+		}
+		switch fields[0] {
+		case "show":
+			showExecution(e, conf, reply)
+		case "diff":
+			reply(fmt.Sprintf("_Diff_ `#%d`: `%s`", e.Id, codeEscaper.Replace(e.Text)))
+			b.runDiff(req, e.Text, e, conf, reply)
+		default:
+			b.rerun(req, e, conf, reply)
+		}
+	case "!!":
+		executions, err := b.history.last(1, func(e *execution) bool {
+			return e.User == req.user && e.Channel == req.channel
+		})
+		if err != nil {
+			reply(fmt.Sprintf("error reading history: %v", err))
+			return
+		}
+		if len(executions) == 0 {
+			reply("No previous actions")
+			return
+		}
+		b.rerun(req, executions[0], conf, reply)
+	}
+}
+
+// record stores the chat action execution if the history is enabled
+func (b *bot) record(req *chatRequest, a *action, text string, results []execResult) {
+	if b.history == nil {
+		return
+	}
+	e := &execution{
+		Time:    time.Now(),
+		User:    req.user,
+		Client:  req.client,
+		Channel: req.channel,
+		Text:    text,
+		Group:   a.group.Id,
+		Command: a.command.Id,
+		Results: results,
+	}
+	if err := b.history.add(e); err != nil {
+		req.log.Error("Error saving history", "err", err)
+	}
+}
+
+// diffFlag removes the --diff flag from the action fields and reports whether it was set
+func diffFlag(fields []string) ([]string, bool) {
+	var result []string
+	found := false
+	for _, f := range fields {
+		if f == "--diff" {
+			found = true
+			continue
+		}
+		result = append(result, f)
+	}
+	return result, found
+}
+
+// runDiff runs the action and posts unified diffs of outputs against the base execution
+// or the last stored run of the same command on the same host if the base is nil
+func (b *bot) runDiff(req *chatRequest, text string, base *execution, conf *config.Config, reply replyFunc) {
+	if b.history == nil {
+		reply("History is disabled")
+		return
+	}
+	a, err := parseAction(text, conf)
+	if err != nil {
+		reply(fmt.Sprintf("%v", err))
+		return
+	}
+	a.log = req.log
+	results := make([]execResult, 0, len(a.hosts))
+	for _, host := range a.hosts {
+		if len(a.hosts) > 1 {
+			reply(fmt.Sprintf("*%s*", mrkdwnEscaper.Replace(host.Id)))
+		}
+		prev, prevResult, err := b.previousResult(req, a, host, base)
+		if err != nil {
+			reply(fmt.Sprintf("error reading history: %v", err))
+			continue
+		}
+		r, res, err := runHost(a, host, b.run)
+		results = append(results, r)
+		if err != nil {
+			reply(fmt.Sprintf("error execution action: %v", err))
+			if res != nil {
+				replyOutput(a, res, reply)
+			}
+			continue
+		}
+		if prevResult == nil {
+			reply("No previous run to compare with, the output is stored")
+			continue
+		}
+		from, _ := a.redactor.Redact(sanitizeOutput(prevResult.Output))
+		to, redacted := a.redactor.Redact(sanitizeOutput(res.output))
+		from, to = a.filter.Apply(from), a.filter.Apply(to)
+		d, err := diff.Unified(from, to, fmt.Sprintf("#%d %s", prev.Id, prev.Time.Format("2006-01-02 15:04 MST")), "now", diffContext)
+		if err == diff.ErrTooDifferent {
+			reply(fmt.Sprintf("Outputs differ too much since `#%d`, more than %d lines changed", prev.Id, diff.MaxChanges))
+			continue
+		}
+		if d == "" {
+			reply(fmt.Sprintf("No changes since `#%d`", prev.Id))
+			continue
+		}
+		for _, msg := range outputMessages(d, true, a.command.MaxSymbolsPerMessage, a.command.MaxMessages) {
+			reply(msg)
+		}
+		if redacted > 0 {
+			reply(redactedNote(redacted))
+		}
+	}
+	b.record(req, a, text, results)
+}
+
+// previousResult returns the base execution result on the host, or if the base is nil,
+// the last stored execution of the same rendered command on the host in the request channel
+func (b *bot) previousResult(req *chatRequest, a *action, host *config.Host, base *execution) (*execution, *execResult, error) {
+	find := func(e *execution, matchCmd bool) *execResult {
+		for i, r := range e.Results {
+			if r.Host == host.Id && r.Error == "" && (!matchCmd || r.Cmd == a.rawCmds[host.Id]) {
+				return &e.Results[i]
+			}
+		}
+		return nil
+	}
+	if base != nil {
+		return base, find(base, false), nil
+	}
+	executions, err := b.history.last(1, func(e *execution) bool {
+		return e.Channel == req.channel && e.Group == a.group.Id && e.Command == a.command.Id && find(e, true) != nil
+	})
+	if err != nil || len(executions) == 0 {
+		return nil, nil, err
+	}
+	return executions[0], find(executions[0], true), nil
+}
+
+// rerun runs the stored execution action again with the current config
+func (b *bot) rerun(req *chatRequest, e *execution, conf *config.Config, reply replyFunc) {
+	reply(fmt.Sprintf("_Rerun_ `#%d`: `%s`", e.Id, codeEscaper.Replace(e.Text)))
+	b.handleAction(req, e.Text, conf, reply)
+}
+
+// historyList returns the executions list with their ids, authors and exit codes
+func historyList(executions []*execution) string {
+	if len(executions) == 0 {
+		return "No history"
+	}
+	var b strings.Builder
+	b.WriteString("_*History:*_")
+	for _, e := range executions {
+		b.WriteString(fmt.Sprintf("\n`#%d`   %s   %s   `%s`   %s", e.Id, e.Time.Format("2006-01-02 15:04 MST"), e.author(), codeEscaper.Replace(e.Text), e.status()))
+	}
+	return b.String()
+}
+
+// author returns the user mention or the API client of the execution
+func (e *execution) author() string {
+	if e.Client != "" {
+		return fmt.Sprintf("_API_ `%s`", e.Client)
+	}
+	return fmt.Sprintf("<@%s>", e.User)
+}
+
+// status returns the execution exit codes or errors summary
+func (e *execution) status() string {
+	var statuses []string
+	for _, r := range e.Results {
+		status := fmt.Sprintf("exit %d", r.ExitCode)
+		if r.Error != "" {
+			status = "error"
+		}
+		if len(e.Results) > 1 {
+			status = r.Host + ": " + status
+		}
+		statuses = append(statuses, status)
+	}
+	return "_" + strings.Join(statuses, ", ") + "_"
+}
+
+// showExecution sends the full stored output, it isn't truncated by the command messages limit
+func showExecution(e *execution, conf *config.Config, reply replyFunc) {
+	reply(fmt.Sprintf("`#%d`   %s   %s   `%s`", e.Id, e.Time.Format("2006-01-02 15:04 MST"), e.author(), codeEscaper.Replace(e.Text)))
+	maxSymbolsPerMessage, code := 0, false
+	redactor := redact.New(conf.Settings.Redactions).WithSecrets(conf.Secrets)
+	if group, exist := conf.Groups[e.Group]; exist {
+		if command, exist := group.Commands[e.Command]; exist {
+			maxSymbolsPerMessage, code = command.MaxSymbolsPerMessage, command.CodeBlock
+			redactor = redact.New(conf.Settings.Redactions, command.Redactions).WithSecrets(conf.Secrets)
+		}
+	}
+	for _, r := range e.Results {
+		if len(e.Results) > 1 {
+			reply(fmt.Sprintf("*%s*", mrkdwnEscaper.Replace(r.Host)))
+		}
+		if r.Error != "" {
+			reply(fmt.Sprintf("error execution action: %s", r.Error))
+			continue
+		}
+		output, redacted := redactor.Redact(sanitizeOutput(r.Output))
+		for _, msg := range outputMessages(output, code, maxSymbolsPerMessage, 0) {
+			reply(msg)
+		}
+		if redacted > 0 {
+			reply(redactedNote(redacted))
+		}
+	}
+}
+
+const historyHelp = "_*Format:*_\n```history [n]\nshow <id>\nrerun <id>\ndiff <id>\n!!\n<group> [host] <command> [args] --diff```"
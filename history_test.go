@@ -0,0 +1,163 @@
+package main
+
+import (
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/nlopes/slack"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestHistory(t *testing.T, limit int) (*history, func()) {
+	dir, err := ioutil.TempDir("", "bb8bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := openHistory(&config.History{Path: filepath.Join(dir, "history.db"), Limit: limit})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return h, func() {
+		h.close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHistoryStore(t *testing.T) {
+	h, cleanup := openTestHistory(t, 2)
+	defer cleanup()
+
+	for _, channel := range []string{"C1", "C2", "C1"} {
+		if err := h.add(&execution{Channel: channel, Text: "group1 command1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e, err := h.get(1); e != nil || err != nil {
+		t.Errorf("Got expired execution: %v, %v", e, err)
+	}
+	e, err := h.get(2)
+	if err != nil || e == nil || e.Id != 2 || e.Channel != "C2" {
+		t.Errorf("Got execution: %+v, %v", e, err)
+	}
+	executions, err := h.last(10, func(e *execution) bool {
+		return e.Channel == "C1"
+	})
+	if err != nil || len(executions) != 1 || executions[0].Id != 3 {
+		t.Errorf("Got executions: %+v, %v", executions, err)
+	}
+}
+
+func TestHistoryCommands(t *testing.T) {
+	h, cleanup := openTestHistory(t, 10)
+	defer cleanup()
+
+	conf := makeTestConfig()
+	store := &configStore{}
+	store.current.Store(conf)
+	b := &bot{
+		store:   store,
+		history: h,
+		run: func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+			return &result{output: "line1\nline2\nline3", exitCode: 0}, nil
+		},
+	}
+	conf.Settings.Admins = map[string]struct{}{"A1": {}}
+	conf.Groups["group1"].Commands["command1"].MaxMessages = 1
+	conf.Groups["group1"].Commands["command1"].MaxSymbolsPerMessage = 6
+
+	tests := []struct {
+		user    string
+		channel string
+		text    string
+		replies []string
+	}{
+		{"U1", "C1", "history", []string{"No history"}},
+		{"U1", "C1", "!!", []string{"No previous actions"}},
+		{"U1", "C1", "group1   command1", []string{"line1"}},
+		{"U2", "C1", "show 1", []string{"`#1`   <time>   <@U1>   `group1 command1`", "line1", "line2", "line3"}},
+		{"U2", "C1", "show 7", []string{"execution *#7* not found"}},
+		{"U2", "C1", "show x", []string{historyHelp}},
+		{"U2", "C2", "show 1", []string{"execution *#1* not found"}},
+		{"U2", "C2", "rerun 1", []string{"execution *#1* not found"}},
+		{"A1", "C2", "show 1", []string{"`#1`   <time>   <@U1>   `group1 command1`", "line1", "line2", "line3"}},
+		{"U2", "C1", "rerun #1", []string{"_Rerun_ `#1`: `group1 command1`", "line1"}},
+		{"U1", "C1", "!!", []string{"_Rerun_ `#1`: `group1 command1`", "line1"}},
+		{"U2", "C1", "history 2", []string{"_*History:*_\n`#3`   <time>   <@U1>   `group1 command1`   _exit 0_\n`#2`   <time>   <@U2>   `group1 command1`   _exit 0_"}},
+		{"U1", "C1", "group1 command1 | grep -v `<x>", []string{"line1"}},
+		{"U2", "C1", "history 1", []string{"_*History:*_\n`#4`   <time>   <@U1>   `group1 command1 | grep -v ˋ&lt;x&gt;`   _exit 0_"}},
+	}
+	for i, test := range tests {
+		var replies []string
+		req := &chatRequest{user: test.user, channel: test.channel, log: logger}
+		checkPermissions(req, conf, "chat")
+		b.handleAction(req, test.text, conf, func(msg string, blocks ...slack.Block) {
+			replies = append(replies, msg)
+		})
+		for j := range replies {
+			replies[j] = historyTime.ReplaceAllString(replies[j], "<time>")
+		}
+		if !reflect.DeepEqual(replies, test.replies) {
+			t.Errorf("%d: Got replies: %q, want: %q", i, replies, test.replies)
+		}
+	}
+
+	b.history = nil
+	var replies []string
+	b.handleAction(&chatRequest{log: logger}, "history", conf, func(msg string, blocks ...slack.Block) {
+		replies = append(replies, msg)
+	})
+	if strings.Join(replies, "") != "History is disabled" {
+		t.Errorf("Got replies: %q", replies)
+	}
+}
+
+var historyTime = regexp.MustCompile(time.Now().Format("2006-01-02") + ` \d\d:\d\d \w+`)
+
+func TestHistoryDiff(t *testing.T) {
+	h, cleanup := openTestHistory(t, 10)
+	defer cleanup()
+
+	conf := makeTestConfig()
+	store := &configStore{}
+	store.current.Store(conf)
+	outputs := []string{"a\nb\nc\n", "a\nb\nc\n", "a\nx\nc\n"}
+	runs := 0
+	b := &bot{
+		store:   store,
+		history: h,
+		run: func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+			output := outputs[runs%len(outputs)]
+			runs++
+			return &result{output: output}, nil
+		},
+	}
+
+	tests := []struct {
+		channel string
+		text    string
+		replies []string
+	}{
+		{"C1", "group1 command1 --diff", []string{"No previous run to compare with, the output is stored"}},
+		{"C1", "group1 command1 --diff", []string{"No changes since `#1`"}},
+		{"C1", "group1 command1 --diff", []string{"```--- #2 <time>\n+++ now\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c```"}},
+		{"C1", "diff 1", []string{"_Diff_ `#1`: `group1 command1`", "No changes since `#1`"}},
+		{"C1", "diff 9", []string{"execution *#9* not found"}},
+		{"C2", "diff 1", []string{"execution *#1* not found"}},
+		{"C2", "group1 command1 --diff", []string{"No previous run to compare with, the output is stored"}},
+	}
+	for i, test := range tests {
+		var replies []string
+		b.handleAction(&chatRequest{user: "U1", channel: test.channel, log: logger}, test.text, conf, func(msg string, blocks ...slack.Block) {
+			replies = append(replies, historyTime.ReplaceAllString(msg, "<time>"))
+		})
+		if !reflect.DeepEqual(replies, test.replies) {
+			t.Errorf("%d: Got replies: %q, want: %q", i, replies, test.replies)
+		}
+	}
+}
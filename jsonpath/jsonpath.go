@@ -0,0 +1,109 @@
+// Package jsonpath implements the simple subset of JSONPath for selecting values from decoded JSON:
+// "$.items[0].name", "items[*].name" and "status".
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path is the parsed JSONPath expression
+type Path struct {
+	expr  string
+	steps []step
+}
+
+// step is the object key or the array index, index -1 means all array elements
+type step struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// Parse parses the path expression with dot separated keys and [n] or [*] array indexes
+func Parse(expr string) (*Path, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	p := &Path{expr: expr}
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("bad json path %q: missing ]", expr)
+			}
+			index := rest[1:end]
+			rest = rest[end+1:]
+			if index == "*" {
+				p.steps = append(p.steps, step{index: -1})
+				continue
+			}
+			if unquoted, err := strconv.Unquote(strings.Replace(index, "'", `"`, -1)); err == nil {
+				p.steps = append(p.steps, step{key: unquoted, isKey: true})
+				continue
+			}
+			i, err := strconv.Atoi(index)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("bad json path %q: bad index %q", expr, index)
+			}
+			p.steps = append(p.steps, step{index: i})
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			p.steps = append(p.steps, step{key: rest[:end], isKey: true})
+			rest = rest[end:]
+		}
+	}
+	return p, nil
+}
+
+// String returns the path expression
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Get returns the value by path from the decoded JSON.
+// Paths with [*] return the slice of the selected values.
+func (p *Path) Get(v interface{}) (interface{}, error) {
+	return get(v, p.steps, p.expr)
+}
+
+func get(v interface{}, steps []step, expr string) (interface{}, error) {
+	for i, s := range steps {
+		if s.isKey {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("json path %q: %q is not an object key", expr, s.key)
+			}
+			v, ok = m[s.key]
+			if !ok {
+				return nil, fmt.Errorf("json path %q: key %q not found", expr, s.key)
+			}
+			continue
+		}
+		a, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("json path %q: value is not an array", expr)
+		}
+		if s.index == -1 {
+			values := make([]interface{}, 0, len(a))
+			for _, e := range a {
+				value, err := get(e, steps[i+1:], expr)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, value)
+			}
+			return values, nil
+		}
+		if s.index >= len(a) {
+			return nil, fmt.Errorf("json path %q: index %d out of range", expr, s.index)
+		}
+		v = a[s.index]
+	}
+	return v, nil
+}
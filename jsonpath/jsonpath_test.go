@@ -0,0 +1,54 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{"status":"ok","disk":{"usage":85.5},"items":[{"name":"a","n":1},{"name":"b","n":2}],"dashed-key":true}`), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		value interface{}
+		err   string
+	}{
+		{"status", "ok", ""},
+		{"$.disk.usage", 85.5, ""},
+		{"items[1].name", "b", ""},
+		{"$.items[*].n", []interface{}{1.0, 2.0}, ""},
+		{"['dashed-key']", true, ""},
+		{"$", data, ""},
+		{"disk.free", nil, `json path "disk.free": key "free" not found`},
+		{"items[2]", nil, `json path "items[2]": index 2 out of range`},
+		{"status[0]", nil, `json path "status[0]": value is not an array`},
+		{"items.name", nil, `json path "items.name": "name" is not an object key`},
+	}
+	for i, test := range tests {
+		p, err := Parse(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := p.Get(data)
+		var e string
+		if err != nil {
+			e = err.Error()
+		}
+		if e != test.err {
+			t.Errorf("%d: Got err: %q, want: %q", i, e, test.err)
+		}
+		if !reflect.DeepEqual(value, test.value) {
+			t.Errorf("%d: Got value: %v, want: %v", i, value, test.value)
+		}
+	}
+
+	for _, bad := range []string{"items[0", "items[x]", "items[-1]"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Got no error for %q", bad)
+		}
+	}
+}
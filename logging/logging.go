@@ -0,0 +1,224 @@
+// Package logging implements leveled structured logs in the text or JSON format
+// with secrets redaction.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karlovskiy/bb8bot/patterns"
+)
+
+// Level is the log level
+type Level int
+
+// Log levels
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the lower case level name
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses the level name: debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+	return Info, fmt.Errorf("bad log level %q", name)
+}
+
+// Format is the log lines format
+type Format int
+
+// Log formats
+const (
+	Text Format = iota
+	JSON
+)
+
+// ParseFormat parses the format name: text or json
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "text":
+		return Text, nil
+	case "json":
+		return JSON, nil
+	}
+	return Text, fmt.Errorf("bad log format %q", name)
+}
+
+// Redacted replaces secrets in log lines
+const Redacted = "[REDACTED]"
+
+// Logger writes log lines with its fields, loggers created by With share the output, level and secrets
+type Logger struct {
+	core   *core
+	fields []interface{}
+}
+
+type core struct {
+	mu      sync.Mutex
+	out     io.Writer
+	level   Level
+	format  Format
+	secrets []string
+	now     func() time.Time
+}
+
+// New returns the logger writing lines with the level or higher to out
+func New(out io.Writer, level Level, format Format) *Logger {
+	return &Logger{core: &core{out: out, level: level, format: format, now: time.Now}}
+}
+
+// With returns the logger adding key value pairs to each line
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &Logger{core: l.core, fields: fields}
+}
+
+// SetSecrets replaces the secret values redacted from log lines
+func (l *Logger) SetSecrets(secrets []string) {
+	values := patterns.Values(secrets)
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	l.core.secrets = values
+}
+
+// AddSecrets adds the secret values redacted from log lines, like the ones resolved after SetSecrets
+func (l *Logger) AddSecrets(secrets ...string) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	l.core.secrets = patterns.Values(append(append([]string(nil), l.core.secrets...), secrets...))
+}
+
+// Enabled reports whether lines of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.core.level
+}
+
+// Debug writes the debug line with key value pairs
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.write(Debug, msg, kv)
+}
+
+// Info writes the info line with key value pairs
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.write(Info, msg, kv)
+}
+
+// Warn writes the warning line with key value pairs
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.write(Warn, msg, kv)
+}
+
+// Error writes the error line with key value pairs
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.write(Error, msg, kv)
+}
+
+// Fatal writes the error line and exits
+func (l *Logger) Fatal(msg string, kv ...interface{}) {
+	l.write(Error, msg, kv)
+	os.Exit(1)
+}
+
+// Output writes the debug line, so the logger could be used by libraries expecting the standard logger
+func (l *Logger) Output(calldepth int, s string) error {
+	l.write(Debug, strings.TrimSpace(s), nil)
+	return nil
+}
+
+func (l *Logger) write(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	c := l.core
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fields := append(append([]interface{}{}, l.fields...), kv...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(missing)")
+	}
+	var b strings.Builder
+	now := c.now().UTC().Format(time.RFC3339Nano)
+	if c.format == JSON {
+		line := map[string]interface{}{
+			"time":  now,
+			"level": level.String(),
+			"msg":   c.redact(msg),
+		}
+		for i := 0; i < len(fields); i += 2 {
+			line[fmt.Sprint(fields[i])] = c.value(fields[i+1])
+		}
+		data, err := json.Marshal(line)
+		if err != nil {
+			data, _ = json.Marshal(map[string]string{"time": now, "level": level.String(), "msg": c.redact(msg), "error": err.Error()})
+		}
+		b.Write(data)
+	} else {
+		b.WriteString(fmt.Sprintf("%s %-5s %s", now, strings.ToUpper(level.String()), c.redact(msg)))
+		for i := 0; i < len(fields); i += 2 {
+			b.WriteString(fmt.Sprintf(" %s=%s", fields[i], quote(fmt.Sprint(c.value(fields[i+1])))))
+		}
+	}
+	b.WriteString("\n")
+	io.WriteString(c.out, b.String())
+}
+
+// value converts the field value to the JSON compatible one with secrets redacted
+func (c *core) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return c.redact(v)
+	case error:
+		return c.redact(v.Error())
+	case fmt.Stringer:
+		return c.redact(v.String())
+	case bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return v
+	case time.Duration:
+		return v.String()
+	}
+	return c.redact(fmt.Sprint(v))
+}
+
+// redact replaces the config secrets and built-in secret patterns
+func (c *core) redact(s string) string {
+	s, _ = patterns.MaskValues(s, c.secrets, Redacted)
+	for _, r := range patterns.Secrets {
+		s, _ = patterns.Mask(s, r, Redacted)
+	}
+	return s
+}
+
+// quote quotes text values with spaces, quotes or equal signs
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLogger(level Level, format Format) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l := New(&buf, level, format)
+	l.core.now = func() time.Time {
+		return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+	return l, &buf
+}
+
+func TestText(t *testing.T) {
+	l, buf := newTestLogger(Info, Text)
+	l.SetSecrets([]string{"gayjke", "xyz"})
+	req := l.With("request_id", "ab12")
+	req.Debug("Skipped")
+	req.Info("Execute command", "host", "onehost", "cmd", "echo gayjke", "timeout", 30*time.Second)
+	req.Error("Failed", "err", errors.New("password=qwerty rejected"), "code", 1)
+	l.Warn("Odd", "key")
+
+	want := `2020-01-02T03:04:05Z INFO  Execute command request_id=ab12 host=onehost cmd="echo [REDACTED]" timeout=30s
+2020-01-02T03:04:05Z ERROR Failed request_id=ab12 err="password=[REDACTED] rejected" code=1
+2020-01-02T03:04:05Z WARN  Odd key=(missing)
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	l, buf := newTestLogger(Debug, JSON)
+	l.With("request_id", "ab12").Debug("Message", "text", "token: xoxb-123-abc", "auth", "Bearer abc.def", "ok", true)
+
+	want := `{"auth":"Bearer [REDACTED]","level":"debug","msg":"Message","ok":true,"request_id":"ab12","text":"token: [REDACTED]","time":"2020-01-02T03:04:05Z"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestAddSecrets(t *testing.T) {
+	l, buf := newTestLogger(Info, Text)
+	l.SetSecrets([]string{"gayjke"})
+	l.AddSecrets("vault-pass", "ab")
+	l.Info("Connect", "password", "gayjke vault-pass ab")
+
+	want := `2020-01-02T03:04:05Z INFO  Connect password="[REDACTED] [REDACTED] ab"` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for i, name := range levelNames {
+		level, err := ParseLevel(name)
+		if err != nil || level != Level(i) {
+			t.Errorf("Got level: %v, %v for %q", level, err, name)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil || err.Error() != `bad log level "verbose"` {
+		t.Errorf("Got err: %v", err)
+	}
+	if f, err := ParseFormat("JSON"); err != nil || f != JSON {
+		t.Errorf("Got format: %v, %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil || err.Error() != `bad log format "xml"` {
+		t.Errorf("Got err: %v", err)
+	}
+}
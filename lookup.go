@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/karlovskiy/bb8bot/suggest"
+	"strings"
+)
+
+// findName returns the target of the name or its unambiguous prefix,
+// otherwise the not found error with suggestions and the help
+func findName(kind, name string, names map[string]string, help string) (string, error) {
+	target, suggestions := suggest.Find(name, names)
+	if target == "" {
+		return "", errors.New(fmt.Sprintf("%s *%s* not found%s\n%s", kind, mrkdwnEscaper.Replace(name), didYouMean(suggestions), help))
+	}
+	return target, nil
+}
+
+// findExactName returns the target of the name, otherwise the not found error with suggestions and the help.
+// Prefixes are only suggested, so commands and argument values aren't run by mistyped names.
+func findExactName(kind, name string, names map[string]string, help string) (string, error) {
+	if target, exist := names[name]; exist {
+		return target, nil
+	}
+	return "", errors.New(fmt.Sprintf("%s *%s* not found%s\n%s", kind, mrkdwnEscaper.Replace(name), didYouMean(suggest.Suggest(name, names)), help))
+}
+
+// didYouMean returns the suggestions text like ", did you mean `unix` or `k8s`?"
+func didYouMean(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		quoted[i] = "`" + s + "`"
+	}
+	text := quoted[len(quoted)-1]
+	if len(quoted) > 1 {
+		text = strings.Join(quoted[:len(quoted)-1], ", ") + " or " + text
+	}
+	return fmt.Sprintf(", did you mean %s?", text)
+}
+
+// groupNames returns groups ids and aliases mapped to ids
+func groupNames(conf *config.Config) map[string]string {
+	names := make(map[string]string)
+	for id, g := range conf.Groups {
+		names[id] = id
+		for _, alias := range g.Aliases {
+			names[alias] = id
+		}
+	}
+	return names
+}
+
+// commandNames returns the group commands ids and aliases mapped to ids
+func commandNames(group *config.Group) map[string]string {
+	names := make(map[string]string)
+	for id, c := range group.Commands {
+		if c.Format == "" {
+			continue
+		}
+		names[id] = id
+		for _, alias := range c.Aliases {
+			names[alias] = id
+		}
+	}
+	return names
+}
+
+// hostNames returns the group hosts ids
+func hostNames(group *config.Group) map[string]string {
+	names := make(map[string]string, len(group.Hosts))
+	for id := range group.Hosts {
+		names[id] = id
+	}
+	return names
+}
+
+// itemNames returns the argument items names
+func itemNames(arg *config.Argument) map[string]string {
+	names := make(map[string]string, len(arg.Items))
+	for _, item := range arg.Items {
+		names[item.Name] = item.Name
+	}
+	return names
+}
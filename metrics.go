@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// Command outcomes
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+	outcomeError   = "error"
+)
+
+var (
+	commandsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bb8bot_commands_total",
+		Help: "Executed commands by group, command, host and outcome: success, failure (non-zero exit code) or error.",
+	}, []string{"group", "command", "host", "outcome"})
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bb8bot_command_duration_seconds",
+		Help:    "Command execution duration including ssh dial.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"group", "command"})
+	activeJobs = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bb8bot_active_jobs",
+		Help: "Commands being executed now.",
+	})
+	sshDialDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "bb8bot_ssh_dial_duration_seconds",
+		Help:    "SSH connection latency including jump hosts.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+	sshDialFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bb8bot_ssh_dial_failures_total",
+		Help: "Failed SSH connections by host.",
+	}, []string{"host"})
+	permissionDenials = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bb8bot_permission_denials_total",
+		Help: "Denied requests by source (chat or api) and reason.",
+	}, []string{"source", "reason"})
+	slackConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bb8bot_slack_connected",
+		Help: "1 if the Slack RTM connection is established.",
+	})
+	slackReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bb8bot_slack_reconnects_total",
+		Help: "Slack RTM reconnections after the first connection.",
+	})
+)
+
+// registerQueueDepth registers the gauge of chat events waiting for handling
+func registerQueueDepth(depth func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "bb8bot_queue_depth",
+		Help: "Incoming chat events waiting for handling.",
+	}, func() float64 {
+		return float64(depth())
+	})
+}
+
+// registerMetrics adds the Prometheus metrics endpoint to the mux
+func registerMetrics(mux *http.ServeMux) {
+	mux.Handle("/metrics", promhttp.Handler())
+}
+
+// observeCommand records the command execution outcome and duration
+func observeCommand(a *action, host string, res *result, err error) {
+	outcome := outcomeSuccess
+	if err != nil {
+		outcome = outcomeError
+	} else if res.exitCode != 0 {
+		outcome = outcomeFailure
+	}
+	commandsTotal.WithLabelValues(a.group.Id, a.command.Id, host, outcome).Inc()
+	if res != nil {
+		commandDuration.WithLabelValues(a.group.Id, a.command.Id).Observe(res.duration.Seconds())
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteMetrics(t *testing.T) {
+	conf := makeTestConfig()
+	a, err := parseAction("group1 command1", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := a.hosts[0]
+	// metrics are global, so only increments are checked
+	before := make(map[string]float64)
+	for _, outcome := range []string{outcomeSuccess, outcomeFailure, outcomeError} {
+		before[outcome] = testutil.ToFloat64(commandsTotal.WithLabelValues("group1", "command1", "onehost", outcome))
+	}
+	runs := []struct {
+		res *result
+		err error
+	}{
+		{&result{duration: time.Second}, nil},
+		{&result{exitCode: 1}, nil},
+		{nil, errors.New("error opening ssh connection")},
+	}
+	for _, r := range runs {
+		a.execute(host, func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+			if active := testutil.ToFloat64(activeJobs); active != 1 {
+				t.Errorf("Got active jobs: %v", active)
+			}
+			return r.res, r.err
+		})
+	}
+	for _, outcome := range []string{outcomeSuccess, outcomeFailure, outcomeError} {
+		if count := testutil.ToFloat64(commandsTotal.WithLabelValues("group1", "command1", "onehost", outcome)) - before[outcome]; count != 1 {
+			t.Errorf("Got %s commands: %v", outcome, count)
+		}
+	}
+	if active := testutil.ToFloat64(activeJobs); active != 0 {
+		t.Errorf("Got active jobs: %v", active)
+	}
+
+	mux := http.NewServeMux()
+	registerMetrics(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`bb8bot_commands_total{command="command1",group="group1",host="onehost",outcome="success"} `,
+		`bb8bot_command_duration_seconds_bucket{command="command1",group="group1",le="1.6"} `,
+		`bb8bot_active_jobs 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Metrics don't contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package patterns holds the patterns of well-known secrets masked in log lines and command outputs.
+package patterns
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MinSecretLength guards against masking short secret values that are parts of usual words
+const MinSecretLength = 4
+
+// Secrets are the patterns of well-known secrets: AWS keys, Slack and bearer tokens,
+// private keys and password, secret or token assignments.
+// If the pattern has a group, the first group is the secret, so the secret name like "password=" is kept.
+var Secrets = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN[A-Z ]* PRIVATE KEY(?: BLOCK)?-----[\s\S]*?-----END[A-Z ]* PRIVATE KEY(?: BLOCK)?-----`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[=:]\s*["']?([0-9A-Za-z/+=]{40})`),
+	regexp.MustCompile(`xox[abposr]-[0-9A-Za-z-]+`),
+	regexp.MustCompile(`(?i)bearer\s+([0-9A-Za-z._~+/=-]+)`),
+	regexp.MustCompile(`(?i)(?:password|passwd|passphrase|secret|token|api_?key)["']?\s*[=:]\s*["']?([^\s"',]+)`),
+}
+
+// Mask replaces the first group of the pattern matches or the whole matches if there are no groups
+// with the mask and returns the text and the number of replaced matches. Already masked ones aren't counted.
+func Mask(text string, pattern *regexp.Regexp, mask string) (string, int) {
+	var result []byte
+	last, count := 0, 0
+	for _, m := range pattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[0], m[1]
+		if len(m) > 2 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if text[start:end] == mask || start == end {
+			continue
+		}
+		result = append(result, text[last:start]...)
+		result = append(result, mask...)
+		last = end
+		count++
+	}
+	if result == nil {
+		return text, 0
+	}
+	return string(append(result, text[last:]...)), count
+}
+
+// Values returns the secret values not shorter than MinSecretLength without duplicates,
+// the longer first, so the secrets containing other ones are fully masked
+func Values(secrets []string) []string {
+	seen := make(map[string]struct{})
+	var values []string
+	for _, s := range secrets {
+		if _, exist := seen[s]; exist || len(s) < MinSecretLength {
+			continue
+		}
+		seen[s] = struct{}{}
+		values = append(values, s)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	return values
+}
+
+// MaskValues replaces the secret values with the mask and returns the text and the number of replaced values
+func MaskValues(text string, values []string, mask string) (string, int) {
+	count := 0
+	for _, v := range values {
+		if n := strings.Count(text, v); n > 0 {
+			text = strings.Replace(text, v, mask, -1)
+			count += n
+		}
+	}
+	return text, count
+}
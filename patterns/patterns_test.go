@@ -0,0 +1,48 @@
+package patterns
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		text  string
+		want  string
+		count int
+	}{
+		{"password=one token: two", "password=*** token: ***", 2},
+		{"password=***", "password=***", 0},
+		{"Bearer abc.def", "Bearer ***", 1},
+		{"xoxb-123-abc", "***", 1},
+		{"nothing", "nothing", 0},
+	}
+	for i, test := range tests {
+		text, count := test.text, 0
+		for _, p := range Secrets {
+			var n int
+			text, n = Mask(text, p, "***")
+			count += n
+		}
+		if text != test.want {
+			t.Errorf("%d: Got text: %q, want: %q", i, text, test.want)
+		}
+		if count != test.count {
+			t.Errorf("%d: Got count: %v, want: %v", i, count, test.count)
+		}
+	}
+	if text, count := Mask("a1 b2", regexp.MustCompile(`[ab](\d)?`), "*"); text != "a* b*" || count != 2 {
+		t.Errorf("Got text: %q, count: %v for group", text, count)
+	}
+}
+
+func TestValues(t *testing.T) {
+	values := Values([]string{"abc", "secret", "secret-long", "", "secret"})
+	if want := []string{"secret-long", "secret"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("Got values: %q, want: %q", values, want)
+	}
+	if text, count := MaskValues("secret-long secret", values, "***"); text != "*** ***" || count != 2 {
+		t.Errorf("Got text: %q, count: %v", text, count)
+	}
+}
@@ -0,0 +1,410 @@
+// Package pipeline implements output filters like "grep -v LISTEN | sort -k 2 | head 20"
+// applied by the bot to command outputs instead of running them in the remote shell.
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultLines is the number of lines for head and tail without the count
+const defaultLines = 10
+
+// Pipeline is the parsed filters chain
+type Pipeline struct {
+	Text    string
+	filters []filter
+}
+
+// filter transforms output lines
+type filter func(lines []string) []string
+
+// Parse parses filters separated by "|", arguments could be quoted, so patterns like 'a|b' are kept
+func Parse(text string) (*Pipeline, error) {
+	p := &Pipeline{Text: strings.TrimSpace(text)}
+	for rest, last := text, false; !last; {
+		part := rest
+		if i := Index(rest); i >= 0 {
+			part, rest = rest[:i], rest[i+1:]
+		} else {
+			last = true
+		}
+		args, err := splitArgs(part)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("empty filter")
+		}
+		parse, exist := parsers[args[0]]
+		if !exist {
+			return nil, fmt.Errorf("unknown filter *%s*, available: grep, head, tail, wc, sort, cut", args[0])
+		}
+		f, err := parse(args[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", args[0], err)
+		}
+		p.filters = append(p.filters, f)
+	}
+	return p, nil
+}
+
+// Apply applies filters to the output, the nil pipeline returns the output as is
+func (p *Pipeline) Apply(output string) string {
+	if p == nil {
+		return output
+	}
+	trailing := strings.HasSuffix(output, "\n")
+	var lines []string
+	if output != "" {
+		lines = strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	}
+	for _, f := range p.filters {
+		lines = f(lines)
+	}
+	result := strings.Join(lines, "\n")
+	if trailing && result != "" {
+		result += "\n"
+	}
+	return result
+}
+
+var parsers map[string]func(args []string) (filter, error)
+
+func init() {
+	parsers = map[string]func(args []string) (filter, error){
+		"grep": parseGrep,
+		"head": parseHead,
+		"tail": parseTail,
+		"wc":   parseWc,
+		"sort": parseSort,
+		"cut":  parseCut,
+	}
+}
+
+// parseGrep parses grep [-v] [-i] <regex>
+func parseGrep(args []string) (filter, error) {
+	invert, ignoreCase := false, false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 'v':
+				invert = true
+			case 'i':
+				ignoreCase = true
+			case 'E':
+				// regular expressions are always extended
+			default:
+				return nil, fmt.Errorf("unknown flag -%c", flag)
+			}
+		}
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected one pattern")
+	}
+	expr := args[0]
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	r, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("bad pattern: %v", err)
+	}
+	return func(lines []string) []string {
+		var result []string
+		for _, l := range lines {
+			if r.MatchString(l) != invert {
+				result = append(result, l)
+			}
+		}
+		return result
+	}, nil
+}
+
+// parseCount parses the lines count: N, -N or -n N
+func parseCount(args []string) (int, error) {
+	switch {
+	case len(args) == 0:
+		return defaultLines, nil
+	case len(args) == 2 && args[0] == "-n":
+		args = args[1:]
+	case len(args) != 1:
+		return 0, fmt.Errorf("expected lines count")
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(args[0], "-"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad lines count %q", args[0])
+	}
+	return n, nil
+}
+
+// parseHead parses head [N]
+func parseHead(args []string) (filter, error) {
+	n, err := parseCount(args)
+	if err != nil {
+		return nil, err
+	}
+	return func(lines []string) []string {
+		if len(lines) > n {
+			return lines[:n]
+		}
+		return lines
+	}, nil
+}
+
+// parseTail parses tail [N]
+func parseTail(args []string) (filter, error) {
+	n, err := parseCount(args)
+	if err != nil {
+		return nil, err
+	}
+	return func(lines []string) []string {
+		if len(lines) > n {
+			return lines[len(lines)-n:]
+		}
+		return lines
+	}, nil
+}
+
+// parseWc parses wc [-l|-w|-c], without flags lines, words and characters are counted
+func parseWc(args []string) (filter, error) {
+	mode := ""
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && (args[0] == "-l" || args[0] == "-w" || args[0] == "-c"):
+		mode = args[0]
+	default:
+		return nil, fmt.Errorf("expected -l, -w or -c")
+	}
+	return func(lines []string) []string {
+		words, chars := 0, 0
+		for _, l := range lines {
+			words += len(strings.Fields(l))
+			chars += utf8.RuneCountInString(l) + 1
+		}
+		switch mode {
+		case "-l":
+			return []string{strconv.Itoa(len(lines))}
+		case "-w":
+			return []string{strconv.Itoa(words)}
+		case "-c":
+			return []string{strconv.Itoa(chars)}
+		}
+		return []string{fmt.Sprintf("%d %d %d", len(lines), words, chars)}
+	}, nil
+}
+
+// parseSort parses sort [-r] [-n] [-u] [-k N], -k sorts by the whitespace separated field
+func parseSort(args []string) (filter, error) {
+	reverse, numeric, unique, key := false, false, false, 0
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-k":
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("-k expects field number")
+			}
+			i++
+			k, err := strconv.Atoi(args[i])
+			if err != nil || k <= 0 {
+				return nil, fmt.Errorf("bad field number %q", args[i])
+			}
+			key = k
+		default:
+			if !strings.HasPrefix(args[i], "-") || len(args[i]) < 2 {
+				return nil, fmt.Errorf("unexpected %q", args[i])
+			}
+			for _, flag := range args[i][1:] {
+				switch flag {
+				case 'r':
+					reverse = true
+				case 'n':
+					numeric = true
+				case 'u':
+					unique = true
+				default:
+					return nil, fmt.Errorf("unknown flag -%c", flag)
+				}
+			}
+		}
+	}
+	value := func(l string) string {
+		if key == 0 {
+			return l
+		}
+		fields := strings.Fields(l)
+		if key > len(fields) {
+			return ""
+		}
+		return fields[key-1]
+	}
+	less := func(a, b string) bool {
+		if numeric {
+			x, errX := strconv.ParseFloat(value(a), 64)
+			y, errY := strconv.ParseFloat(value(b), 64)
+			if errX == nil && errY == nil && x != y {
+				return x < y
+			}
+			if (errX == nil) != (errY == nil) {
+				// not numbers go first like in sort -n
+				return errX != nil
+			}
+		}
+		return value(a) < value(b)
+	}
+	return func(lines []string) []string {
+		result := append([]string(nil), lines...)
+		sort.SliceStable(result, func(i, j int) bool {
+			if reverse {
+				return less(result[j], result[i])
+			}
+			return less(result[i], result[j])
+		})
+		if unique {
+			var deduped []string
+			for i, l := range result {
+				if i == 0 || l != result[i-1] {
+					deduped = append(deduped, l)
+				}
+			}
+			result = deduped
+		}
+		return result
+	}, nil
+}
+
+// parseCut parses cut -f LIST [-d DELIM], fields are whitespace separated if the delimiter isn't set.
+// LIST is comma separated field numbers and ranges like "1,3-4,6-".
+func parseCut(args []string) (filter, error) {
+	var list, delim string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-f", "-d":
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("%s expects value", args[i])
+			}
+			if args[i] == "-f" {
+				list = args[i+1]
+			} else {
+				delim = args[i+1]
+			}
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q", args[i])
+		}
+	}
+	if list == "" {
+		return nil, fmt.Errorf("fields list is not set")
+	}
+	type fieldRange struct{ from, to int }
+	var ranges []fieldRange
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil || from <= 0 {
+			return nil, fmt.Errorf("bad fields list %q", list)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if bounds[1] == "" {
+				to = 0
+			} else if to, err = strconv.Atoi(bounds[1]); err != nil || to < from {
+				return nil, fmt.Errorf("bad fields list %q", list)
+			}
+		}
+		ranges = append(ranges, fieldRange{from, to})
+	}
+	return func(lines []string) []string {
+		result := make([]string, 0, len(lines))
+		for _, l := range lines {
+			var fields []string
+			join := delim
+			if delim == "" {
+				fields = strings.Fields(l)
+				join = " "
+			} else {
+				fields = strings.Split(l, delim)
+			}
+			var selected []string
+			for i := range fields {
+				for _, r := range ranges {
+					if i+1 >= r.from && (r.to == 0 || i+1 <= r.to) {
+						selected = append(selected, fields[i])
+						break
+					}
+				}
+			}
+			result = append(result, strings.Join(selected, join))
+		}
+		return result
+	}, nil
+}
+
+// splitArgs splits the filter text into arguments, single, double and chat smart quotes group arguments
+func splitArgs(text string) ([]string, error) {
+	var args []string
+	var b strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range text {
+		switch {
+		case quote != 0:
+			if closesQuote(quote, r) {
+				quote = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case isQuote(r):
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+		default:
+			b.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote in %q", strings.TrimSpace(text))
+	}
+	if inArg {
+		args = append(args, b.String())
+	}
+	return args, nil
+}
+
+// Index returns the index of the first "|" outside quotes in the text, or -1 if there is no such one
+func Index(text string) int {
+	var quote rune
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if closesQuote(quote, r) {
+				quote = 0
+			}
+		case isQuote(r):
+			quote = r
+		case r == '|':
+			return i
+		}
+	}
+	return -1
+}
+
+// isQuote reports whether the rune opens the quoted argument, smart quotes of chat clients are supported
+func isQuote(r rune) bool {
+	return r == '"' || r == '\'' || r == '“' || r == '‘'
+}
+
+// closesQuote reports whether the rune closes the argument opened by the quote
+func closesQuote(quote, r rune) bool {
+	return r == quote || (quote == '“' && r == '”') || (quote == '‘' && r == '’')
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"testing"
+)
+
+const testOutput = `sshd  812 root  TCP *:22 (LISTEN)
+sshd 9021 root  TCP 10.0.0.1:22->10.0.0.7:51234 (ESTABLISHED)
+sshd 9140 admin TCP 10.0.0.1:22->10.0.0.9:40022 (ESTABLISHED)
+sshd  977 root  TCP [::]:22 (LISTEN)
+`
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		filters string
+		output  string
+		err     string
+	}{
+		{"grep ESTABLISHED | wc -l", "2\n", ""},
+		{"grep -v ESTAB | cut -f 2", "812\n977\n", ""},
+		{"grep -i listen | head 1", "sshd  812 root  TCP *:22 (LISTEN)\n", ""},
+		{"grep 'TCP \\[' | cut -f 1-2", "sshd 977\n", ""},
+		{"grep “10.0.0.9”|cut -f3", "", "cut: unexpected \"-f3\""},
+		{"grep “10.0.0.9” | cut -f 3", "admin\n", ""},
+		{"sort -n -k 2 | cut -f 2", "812\n977\n9021\n9140\n", ""},
+		{"sort -rn -k 2 | tail -n 1 | cut -f 2", "812\n", ""},
+		{"cut -f 3 | sort -u", "admin\nroot\n", ""},
+		{"grep ESTABLISHED | cut -d : -f 3-", "51234 (ESTABLISHED)\n40022 (ESTABLISHED)\n", ""},
+		{"head -2 | wc", "2 12 96\n", ""},
+		{"grep nothing", "", ""},
+		{"grep", "", "grep: expected one pattern"},
+		{"grep (", "", "grep: bad pattern: error parsing regexp: missing closing ): `(`"},
+		{"head 0", "", `head: bad lines count "0"`},
+		{"sort -x", "", "sort: unknown flag -x"},
+		{"cut -f 2-1", "", `cut: bad fields list "2-1"`},
+		{"wc -m", "", "wc: expected -l, -w or -c"},
+		{"grep x |", "", "empty filter"},
+		{"rm -rf /", "", "unknown filter *rm*, available: grep, head, tail, wc, sort, cut"},
+		{"grep 'x", "", `unclosed quote in "grep 'x"`},
+		{"grep 'x | head", "", `unclosed quote in "grep 'x | head"`},
+		{"grep 'ESTABLISHED|LISTEN' | wc -l", "4\n", ""},
+		{`grep "9021|9140" | cut -f 3`, "root\nadmin\n", ""},
+		{`grep -E "(812|977)" | cut -f 2`, "812\n977\n", ""},
+		{"grep “admin|812” | wc -l", "2\n", ""},
+	}
+	for i, test := range tests {
+		p, err := Parse(test.filters)
+		var e string
+		if err != nil {
+			e = err.Error()
+		}
+		if e != test.err {
+			t.Errorf("%d: Got err: %v, want: %v", i, e, test.err)
+		}
+		if err != nil {
+			continue
+		}
+		if output := p.Apply(testOutput); output != test.output {
+			t.Errorf("%d: Got output: %q, want: %q", i, output, test.output)
+		}
+	}
+}
+
+func TestApplyNil(t *testing.T) {
+	var p *Pipeline
+	if output := p.Apply(testOutput); output != testOutput {
+		t.Errorf("Got output: %q, want: %q", output, testOutput)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	tests := []struct {
+		text  string
+		index int
+	}{
+		{"unix lsof", -1},
+		{"unix lsof | head", 10},
+		{"unix lsof | grep 'a|b'", 10},
+		{"grep 'a|b' | head", 11},
+		{`grep "a|b"`, -1},
+		{"grep “a|b” | head", 15},
+		{"grep 'a|b", -1},
+	}
+	for i, test := range tests {
+		if index := Index(test.text); index != test.index {
+			t.Errorf("%d: Got index: %d, want: %d", i, index, test.index)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Package redact masks secrets in command outputs by regular expressions.
+package redact
+
+import (
+	"regexp"
+
+	"github.com/karlovskiy/bb8bot/patterns"
+)
+
+// Mask replaces redacted secrets
+const Mask = "[REDACTED]"
+
+// Builtin are the patterns of well-known secrets shared with the log redaction
+var Builtin = patterns.Secrets
+
+// builtin is the redactor with the built-in rules only
+var builtin = New()
+
+// Redactor masks the secret values, matches of the built-in and additional rules.
+// If the rule has groups, only the first group is masked, so the secret name like "password=" is kept.
+type Redactor struct {
+	rules   []*regexp.Regexp
+	secrets func() []string
+}
+
+// New returns the redactor with the built-in rules and the rules lists
+func New(rules ...[]*regexp.Regexp) *Redactor {
+	r := &Redactor{rules: append([]*regexp.Regexp(nil), Builtin...)}
+	for _, list := range rules {
+		r.rules = append(r.rules, list...)
+	}
+	return r
+}
+
+// WithSecrets makes the redactor also mask the secret values, they are read on each redaction,
+// so the secrets resolved later like vault ones are masked too
+func (r *Redactor) WithSecrets(secrets func() []string) *Redactor {
+	r.secrets = secrets
+	return r
+}
+
+// Redact returns the text with masked secrets and the number of masked secrets,
+// the nil redactor masks secrets by the built-in rules
+func (r *Redactor) Redact(text string) (string, int) {
+	if r == nil {
+		r = builtin
+	}
+	count := 0
+	if r.secrets != nil {
+		text, count = patterns.MaskValues(text, patterns.Values(r.secrets()), Mask)
+	}
+	for _, rule := range r.rules {
+		var n int
+		text, n = patterns.Mask(text, rule, Mask)
+		count += n
+	}
+	return text, count
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/karlovskiy/bb8bot/config"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// reloadDebounce is the delay for collecting burst of file change events into one reload
+const reloadDebounce = 500 * time.Millisecond
+
+// configStore keeps the current config and atomically swaps it on reload.
+// Every action loads the config once, so in-flight jobs keep the config they started with.
+// The current config is the parsed one with discovered hosts.
+type configStore struct {
+	path       string
+	mu         sync.Mutex
+	base       *config.Config
+	discovered map[string][]*config.Host
+	current    atomic.Value
+	listeners  []func(*config.Config)
+}
+
+// newConfigStore parses the config file and returns the store with it
+func newConfigStore(path string) (*configStore, error) {
+	conf, err := config.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &configStore{
+		path:       path,
+		base:       conf,
+		discovered: make(map[string][]*config.Host),
+	}
+	s.current.Store(conf)
+	return s, nil
+}
+
+// Load returns the current config
+func (s *configStore) Load() *config.Config {
+	return s.current.Load().(*config.Config)
+}
+
+// Reload parses and validates the config file and swaps it in.
+// The current config stays untouched if the new one is invalid.
+// Listeners are called without the lock, so they could use the store.
+func (s *configStore) Reload() (*config.Config, error) {
+	s.mu.Lock()
+	conf, err := config.ParseFile(s.path)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if s.base.Settings.Token != conf.Settings.Token {
+		logger.Warn("Slack token was changed, restart is required to apply it", "path", s.path)
+	}
+	s.base = conf
+	s.publish()
+	current := s.Load()
+	listeners := make([]func(*config.Config), len(s.listeners))
+	copy(listeners, s.listeners)
+	s.mu.Unlock()
+
+	logger.Info("Config reloaded", "path", s.path)
+	for _, listener := range listeners {
+		listener(current)
+	}
+	return current, nil
+}
+
+// onReload registers the listener called after each successful reload
+func (s *configStore) onReload(listener func(*config.Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// setDiscovered replaces hosts of the discovery and swaps in the config with them
+func (s *configStore) setDiscovered(discoveryId string, hosts []*config.Host) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.discovered[discoveryId] = hosts
+	s.publish()
+}
+
+// publish swaps in the parsed config with discovered hosts, s.mu must be held
+func (s *configStore) publish() {
+	discoveries := make(map[string]struct{})
+	for _, d := range s.base.Discoveries {
+		discoveries[d.Id] = struct{}{}
+	}
+	for id := range s.discovered {
+		if _, exist := discoveries[id]; !exist {
+			delete(s.discovered, id)
+		}
+	}
+	s.current.Store(s.base.WithDiscoveredHosts(s.discovered))
+}
+
+// discoveries returns discoveries of the parsed config
+func (s *configStore) discoveries() []*config.Discovery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.base.Discoveries
+}
+
+// watch reloads the config on SIGHUP and on config file changes
+func (s *configStore) watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error("Error creating config watcher", "err", err)
+	} else {
+		defer watcher.Close()
+		s.watchFiles(watcher)
+		events = watcher.Events
+		errs = watcher.Errors
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-hup:
+			logger.Info("SIGHUP received, reloading config", "path", s.path)
+			s.reload()
+		case ev := <-events:
+			if s.isConfigFile(ev.Name) && ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+				debounce = time.After(reloadDebounce)
+			}
+		case err := <-errs:
+			logger.Error("Config watcher error", "err", err)
+		case <-debounce:
+			debounce = nil
+			logger.Info("Config changed, reloading", "path", s.path)
+			s.reload()
+			s.watchFiles(watcher)
+		}
+	}
+}
+
+// watchFiles adds directories of the config files and the include patterns to the watcher,
+// because editors and config maps replace files instead of writing them
+func (s *configStore) watchFiles(watcher *fsnotify.Watcher) {
+	dirs := map[string]struct{}{filepath.Dir(s.path): {}}
+	if info, err := os.Stat(s.path); err == nil && info.IsDir() {
+		dirs[filepath.Clean(s.path)] = struct{}{}
+	}
+	conf := s.Load()
+	for _, f := range conf.Files {
+		dirs[filepath.Dir(f)] = struct{}{}
+	}
+	// new files matching includes are loaded on reload, so their directories are watched even if they are empty
+	for _, pattern := range conf.Includes {
+		matches, _ := filepath.Glob(filepath.Dir(pattern))
+		for _, dir := range matches {
+			dirs[dir] = struct{}{}
+		}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			logger.Error("Error watching config directory", "dir", dir, "err", err)
+		}
+	}
+}
+
+// isConfigFile reports whether the changed file is one of the config files
+func (s *configStore) isConfigFile(name string) bool {
+	name = filepath.Clean(name)
+	if name == filepath.Clean(s.path) {
+		return true
+	}
+	// new files in the config directory are loaded on reload too
+	if filepath.Ext(name) == ".toml" && filepath.Dir(name) == filepath.Clean(s.path) {
+		return true
+	}
+	conf := s.Load()
+	for _, f := range conf.Files {
+		if name == f {
+			return true
+		}
+	}
+	for _, pattern := range conf.Includes {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// reload reloads config and logs the error if the new config is invalid
+func (s *configStore) reload() {
+	if _, err := s.Reload(); err != nil {
+		logger.Error("Error reloading config, keeping the current one", "path", s.path, "err", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"github.com/karlovskiy/bb8bot/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigStoreReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bb8bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(path, []byte("[settings]\ntoken = \"xoxb-1\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := newConfigStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := store.Load()
+
+	if err := ioutil.WriteFile(path, []byte("[[group]]\nid = \"group1\"\nhosts = [\"nohost\"]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Reload(); err == nil {
+		t.Fatal("Got no error for invalid config")
+	}
+	if store.Load() != old {
+		t.Fatal("Invalid config was swapped in")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("[settings]\ntoken = \"xoxb-1\"\n[[group]]\nid = \"group1\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := store.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Load() != conf || conf == old {
+		t.Fatal("Valid config wasn't swapped in")
+	}
+	if _, exist := old.Groups["group1"]; exist {
+		t.Fatal("Old config was changed by reload")
+	}
+	if _, exist := conf.Groups["group1"]; !exist {
+		t.Fatal("New config doesn't contain group1")
+	}
+
+	var notified *config.Config
+	store.onReload(func(c *config.Config) {
+		// listeners could use the store
+		store.discoveries()
+		notified = c
+	})
+	done := make(chan struct{})
+	go func() {
+		conf, err = store.Reload()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reload with the listener using the store is locked")
+	}
+	if err != nil || notified != conf || store.Load() != conf {
+		t.Errorf("Got notified: %p, reloaded: %p, err: %v", notified, conf, err)
+	}
+
+	if reply := reloadConfig(store, false); reply != "Only admins can reload config" {
+		t.Errorf("Got reply: %q for not admin", reply)
+	}
+}
+
+func TestIsConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bb8bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	data := "include = [\"conf.d/*.toml\"]\n[settings]\ntoken = \"xoxb-1\"\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := newConfigStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		config bool
+	}{
+		{path, true},
+		{filepath.Join(dir, "other.toml"), false},
+		{filepath.Join(dir, "conf.d", "new.toml"), true},
+		{filepath.Join(dir, "conf.d", "new.toml~"), false},
+		{filepath.Join(dir, "conf.d", "sub", "new.toml"), false},
+	}
+	for i, test := range tests {
+		if config := store.isConfigFile(test.name); config != test.config {
+			t.Errorf("%d: Got config file: %v, want: %v", i, config, test.config)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/nlopes/slack"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxFieldsPerSection is the Slack limit of section block fields
+	maxFieldsPerSection = 10
+	// maxBlocks is the Slack limit of message blocks
+	maxBlocks = 50
+	// maxFieldLength is the Slack limit of section block field text
+	maxFieldLength = 2000
+)
+
+// rendered is the structured output rendered for chat
+type rendered struct {
+	// text is the aligned table or the plain text if code is false
+	text string
+	code bool
+	// blocks are the Block Kit fields of the json object, text is their fallback
+	blocks []slack.Block
+}
+
+// renderOutput renders the command output by the output format,
+// blocks are rendered only if allowBlocks is true and the value is a flat json object
+func renderOutput(out *config.Output, output string, allowBlocks bool) (*rendered, error) {
+	switch out.Format {
+	case config.OutputJSON:
+		return renderJSON(out, output, allowBlocks)
+	case config.OutputTable:
+		rows := parseTable(output)
+		if len(rows) == 0 {
+			return &rendered{}, nil
+		}
+		rows, err := selectColumns(rows, out.Columns)
+		if err != nil {
+			return nil, err
+		}
+		return &rendered{text: alignTable(rows), code: true}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("unknown output format %q", out.Format))
+}
+
+// renderJSON renders the json value selected by the json path:
+// objects as Block Kit fields, arrays of objects as tables and other values as text lines
+func renderJSON(out *config.Output, output string, allowBlocks bool) (*rendered, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(output), &value); err != nil {
+		return nil, errors.New(fmt.Sprintf("bad json: %v", err))
+	}
+	if out.JSONPath != nil {
+		var err error
+		value, err = out.JSONPath.Get(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys, err := objectKeys(v, out.Columns)
+		if err != nil {
+			return nil, err
+		}
+		lines := make([]string, len(keys))
+		for i, k := range keys {
+			lines[i] = fmt.Sprintf("*%s*: %s", k, jsonText(v[k]))
+		}
+		r := &rendered{text: strings.Join(lines, "\n")}
+		if allowBlocks && len(keys) > 0 && len(keys) <= maxFieldsPerSection*maxBlocks {
+			r.blocks = objectBlocks(v, keys)
+		}
+		return r, nil
+	case []interface{}:
+		if len(v) == 0 {
+			return &rendered{}, nil
+		}
+		if _, isObject := v[0].(map[string]interface{}); isObject {
+			return renderObjects(v, out.Columns)
+		}
+		lines := make([]string, len(v))
+		for i, item := range v {
+			lines[i] = jsonText(item)
+		}
+		return &rendered{text: strings.Join(lines, "\n")}, nil
+	}
+	return &rendered{text: jsonText(value)}, nil
+}
+
+// renderObjects renders the array of json objects as the table with the columns or all keys
+func renderObjects(objects []interface{}, columns []string) (*rendered, error) {
+	if len(columns) == 0 {
+		seen := make(map[string]struct{})
+		for _, o := range objects {
+			if m, ok := o.(map[string]interface{}); ok {
+				for k := range m {
+					if _, exist := seen[k]; !exist {
+						seen[k] = struct{}{}
+						columns = append(columns, k)
+					}
+				}
+			}
+		}
+		sort.Strings(columns)
+	}
+	rows := [][]string{columns}
+	for _, o := range objects {
+		m, ok := o.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("array item %s is not an object", jsonText(o)))
+		}
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			if v, exist := m[c]; exist {
+				row[i] = jsonText(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return &rendered{text: alignTable(rows), code: true}, nil
+}
+
+// objectKeys returns the columns if all of them exist in the object or the sorted object keys
+func objectKeys(object map[string]interface{}, columns []string) ([]string, error) {
+	if len(columns) > 0 {
+		for _, c := range columns {
+			if _, exist := object[c]; !exist {
+				return nil, errors.New(fmt.Sprintf("key %q not found", c))
+			}
+		}
+		return columns, nil
+	}
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// objectBlocks returns sections with the object keys and values as fields
+func objectBlocks(object map[string]interface{}, keys []string) []slack.Block {
+	var blocks []slack.Block
+	for start := 0; start < len(keys); start += maxFieldsPerSection {
+		end := start + maxFieldsPerSection
+		if end > len(keys) {
+			end = len(keys)
+		}
+		fields := make([]*slack.TextBlockObject, 0, end-start)
+		for _, k := range keys[start:end] {
+			text := fmt.Sprintf("*%s*\n%s", mrkdwnEscaper.Replace(k), mrkdwnEscaper.Replace(jsonText(object[k])))
+			if utf8.RuneCountInString(text) > maxFieldLength {
+				text = string([]rune(text)[:maxFieldLength-1]) + "…"
+			}
+			fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, text, false, false))
+		}
+		blocks = append(blocks, slack.NewSectionBlock(nil, fields, nil))
+	}
+	return blocks
+}
+
+// jsonText returns strings as is, numbers without exponent and other values as compact json
+func jsonText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// parseTable splits the output lines by whitespaces to cells, the first line is the header.
+// Extra cells of the row are joined to the last column, like the COMMAND column of ps.
+func parseTable(output string) [][]string {
+	var rows [][]string
+	for _, line := range strings.Split(output, "\n") {
+		cells := strings.Fields(line)
+		if len(cells) == 0 {
+			continue
+		}
+		if len(rows) > 0 && len(cells) > len(rows[0]) {
+			last := len(rows[0]) - 1
+			cells = append(cells[:last], strings.Join(cells[last:], " "))
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+// selectColumns returns rows with the columns by header names, all rows if columns are empty
+func selectColumns(rows [][]string, columns []string) ([][]string, error) {
+	if len(columns) == 0 {
+		return rows, nil
+	}
+	indexes := make([]int, len(columns))
+	for i, c := range columns {
+		indexes[i] = -1
+		for j, h := range rows[0] {
+			if strings.EqualFold(h, c) {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return nil, errors.New(fmt.Sprintf("column %q not found", c))
+		}
+	}
+	selected := make([][]string, len(rows))
+	for i, row := range rows {
+		selected[i] = make([]string, len(indexes))
+		for j, index := range indexes {
+			if index < len(row) {
+				selected[i][j] = row[index]
+			}
+		}
+	}
+	return selected, nil
+}
+
+// alignTable returns rows with cells padded to the column widths
+func alignTable(rows [][]string) string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		var b strings.Builder
+		for j, cell := range row {
+			b.WriteString(cell)
+			if j < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell)+2))
+			}
+		}
+		lines[i] = strings.TrimRight(b.String(), " ")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/karlovskiy/bb8bot/jsonpath"
+	"github.com/nlopes/slack"
+	"reflect"
+	"testing"
+)
+
+const testPods = `NAME                     READY   STATUS    RESTARTS   AGE
+api-7d9f8c6b5d-x2k4p     1/1     Running   0          3d
+worker-5c4b7d9f8-q8w2n   0/1     CrashLoopBackOff   12   1h
+`
+
+const testJSON = `{"status":"ok","version":"1.4.2","uptime":3600,"items":[{"name":"api","ready":true},{"name":"worker","ready":false,"restarts":12}],"tags":["a","b"]}`
+
+func TestRenderOutput(t *testing.T) {
+	path := func(expr string) *jsonpath.Path {
+		p, err := jsonpath.Parse(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	tests := []struct {
+		out    *config.Output
+		output string
+		text   string
+		code   bool
+		fields []string
+		err    string
+	}{
+		{
+			&config.Output{Format: config.OutputTable},
+			testPods,
+			"NAME                    READY  STATUS            RESTARTS  AGE\n" +
+				"api-7d9f8c6b5d-x2k4p    1/1    Running           0         3d\n" +
+				"worker-5c4b7d9f8-q8w2n  0/1    CrashLoopBackOff  12        1h",
+			true, nil, "",
+		},
+		{
+			&config.Output{Format: config.OutputTable, Columns: []string{"status", "NAME"}},
+			testPods,
+			"STATUS            NAME\nRunning           api-7d9f8c6b5d-x2k4p\nCrashLoopBackOff  worker-5c4b7d9f8-q8w2n",
+			true, nil, "",
+		},
+		{
+			&config.Output{Format: config.OutputTable},
+			"PID CMD\n1 /sbin/init splash\n",
+			"PID  CMD\n1    /sbin/init splash",
+			true, nil, "",
+		},
+		{
+			&config.Output{Format: config.OutputTable, Columns: []string{"IP"}},
+			testPods, "", false, nil, `column "IP" not found`,
+		},
+		{
+			&config.Output{Format: config.OutputJSON, Columns: []string{"status", "uptime"}},
+			testJSON,
+			"*status*: ok\n*uptime*: 3600",
+			false, []string{"*status*\nok", "*uptime*\n3600"}, "",
+		},
+		{
+			&config.Output{Format: config.OutputJSON, JSONPath: path("$.items")},
+			testJSON,
+			"name    ready  restarts\napi     true\nworker  false  12",
+			true, nil, "",
+		},
+		{
+			&config.Output{Format: config.OutputJSON, JSONPath: path("$.items[*].name")},
+			testJSON, "api\nworker", false, nil, "",
+		},
+		{
+			&config.Output{Format: config.OutputJSON, JSONPath: path("$.items[1]")},
+			testJSON,
+			"*name*: worker\n*ready*: false\n*restarts*: 12",
+			false, []string{"*name*\nworker", "*ready*\nfalse", "*restarts*\n12"}, "",
+		},
+		{
+			&config.Output{Format: config.OutputJSON, JSONPath: path("version")},
+			testJSON, "1.4.2", false, nil, "",
+		},
+		{
+			&config.Output{Format: config.OutputJSON, Columns: []string{"missing"}},
+			testJSON, "", false, nil, `key "missing" not found`,
+		},
+		{
+			&config.Output{Format: config.OutputJSON},
+			"not json", "", false, nil, "bad json: invalid character 'o' in literal null (expecting 'u')",
+		},
+	}
+	for i, test := range tests {
+		r, err := renderOutput(test.out, test.output, true)
+		var e string
+		if err != nil {
+			e = err.Error()
+		}
+		if e != test.err {
+			t.Errorf("%d: Got err: %v, want: %v", i, e, test.err)
+		}
+		if err != nil {
+			continue
+		}
+		if r.text != test.text {
+			t.Errorf("%d: Got text: %q, want: %q", i, r.text, test.text)
+		}
+		if r.code != test.code {
+			t.Errorf("%d: Got code: %v, want: %v", i, r.code, test.code)
+		}
+		var fields []string
+		for _, b := range r.blocks {
+			for _, f := range b.(*slack.SectionBlock).Fields {
+				fields = append(fields, f.Text)
+			}
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%d: Got fields: %q, want: %q", i, fields, test.fields)
+		}
+	}
+}
+
+func TestReplyOutput(t *testing.T) {
+	conf := makeTestConfig()
+	command := conf.Groups["group1"].Commands["command1"]
+	command.Output = &config.Output{Format: config.OutputTable, Columns: []string{"NAME", "STATUS"}}
+	run := func(rawCmd string, command *config.Command, host *config.Host) (*result, error) {
+		return &result{stdout: testPods, stderr: "warning: x\n", output: "warning: x\n" + testPods}, nil
+	}
+	tests := []struct {
+		action string
+		msgs   []string
+	}{
+		{"group1 command1", []string{"```NAME                    STATUS\napi-7d9f8c6b5d-x2k4p    Running\nworker-5c4b7d9f8-q8w2n  CrashLoopBackOff```", "_stderr:_", "```warning: x```"}},
+		{"group1 command1 | grep Crash", []string{"```worker-5c4b7d9f8-q8w2n  CrashLoopBackOff```", "_stderr:_", "```warning: x```"}},
+	}
+	for i, test := range tests {
+		a, err := parseAction(test.action, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msgs []string
+		runAction(a, run, func(msg string, blocks ...slack.Block) { msgs = append(msgs, msg) })
+		if !reflect.DeepEqual(msgs, test.msgs) {
+			t.Errorf("%d: Got msgs: %q, want: %q", i, msgs, test.msgs)
+		}
+	}
+}
+
+func TestReplyOutputStderr(t *testing.T) {
+	conf := makeTestConfig()
+	command := conf.Groups["group1"].Commands["command1"]
+	command.Output = &config.Output{Format: config.OutputJSON}
+	a, err := parseAction("group1 command1", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := &result{stdout: `{"a":1}`, stderr: "curl: (6) warning\n", output: "curl: (6) warning\n{\"a\":1}"}
+	var msgs []string
+	replyOutput(a, res, func(msg string, blocks ...slack.Block) { msgs = append(msgs, msg) })
+	if want := []string{"*a*: 1", "_stderr:_", "```curl: (6) warning```"}; !reflect.DeepEqual(msgs, want) {
+		t.Errorf("Got msgs: %q, want: %q", msgs, want)
+	}
+}
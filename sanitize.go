@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// codeFence is the Slack code block delimiter
+const codeFence = "```"
+
+// ansiRegexp matches OSC sequences like terminal titles and links, CSI sequences like colors
+// and cursor movements, charset selections like in tput sgr0 and other two characters escape sequences
+var ansiRegexp = regexp.MustCompile(`\x1b(?:\][^\x07\x1b]*(?:\x07|\x1b\\)|\[[0-?]*[ -/]*[@-~]|[()*+][ -~]|[0-Z\\-_])`)
+
+// mrkdwnEscaper escapes Slack control characters, they must be escaped in all message texts
+var mrkdwnEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// codeEscaper also replaces backticks with the look-alike modifier letter, so they can't close the code block
+var codeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "`", "ˋ")
+
+// sanitizeOutput strips escape sequences and control characters except line feeds and tabs.
+// Carriage returns overwrite the line like in terminals, so only the last progress bar state is kept,
+// and backspaces erase the previous character like in man pages.
+func sanitizeOutput(output string) string {
+	output = ansiRegexp.ReplaceAllString(output, "")
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if j := strings.LastIndex(strings.TrimRight(line, "\r"), "\r"); j >= 0 {
+			line = line[j+1:]
+		}
+		var b []rune
+		for _, r := range line {
+			switch {
+			case r == '\b':
+				if len(b) > 0 {
+					b = b[:len(b)-1]
+				}
+			case r == '\t' || (!unicode.IsControl(r) && r != utf8.RuneError):
+				b = append(b, r)
+			}
+		}
+		lines[i] = string(b)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// redactedNote returns the reply noting the number of secrets redacted from the output
+func redactedNote(n int) string {
+	if n == 1 {
+		return "_1 secret was redacted from the output_"
+	}
+	return fmt.Sprintf("_%d secrets were redacted from the output_", n)
+}
+
+// outputMessages splits the output into messages escaped for Slack mrkdwn, the limit is applied to escaped messages.
+// In the code mode every message is wrapped in its own code block,
+// so the formatting doesn't break when a block is split between messages.
+func outputMessages(output string, code bool, maxSymbolsPerMessage, maxMessages int) []string {
+	if !code {
+		return escapedMessages(output, mrkdwnEscaper, maxSymbolsPerMessage, maxMessages)
+	}
+	if maxSymbolsPerMessage > 2*len(codeFence) {
+		maxSymbolsPerMessage -= 2 * len(codeFence)
+	}
+	msgs := escapedMessages(output, codeEscaper, maxSymbolsPerMessage, maxMessages)
+	for i, msg := range msgs {
+		msgs[i] = codeFence + msg + codeFence
+	}
+	return msgs
+}
+
+// escapedMessages escapes the output and splits it into messages by lines within the limit of escaped
+// symbols, so escape sequences like "&amp;" aren't split and don't push messages over the limit
+func escapedMessages(output string, escaper *strings.Replacer, maxSymbolsPerMessage, maxMessages int) (msgs []string) {
+	var b strings.Builder
+	symbols, lastLF := 0, -1
+	flush := func() {
+		msg := b.String()
+		b.Reset()
+		symbols = 0
+		if lastLF < 0 {
+			msgs = append(msgs, msg)
+			return
+		}
+		// the message is split at the last line feed, the rest is carried to the next message
+		if msg[:lastLF] != "" {
+			msgs = append(msgs, msg[:lastLF])
+		}
+		b.WriteString(msg[lastLF+1:])
+		symbols = utf8.RuneCountInString(msg[lastLF+1:])
+		lastLF = -1
+	}
+	for _, r := range output {
+		unit := escaper.Replace(string(r))
+		n := utf8.RuneCountInString(unit)
+		for maxSymbolsPerMessage > 0 && symbols > 0 && symbols+n > maxSymbolsPerMessage {
+			flush()
+			if maxMessages > 0 && len(msgs) == maxMessages {
+				return
+			}
+		}
+		if r == '\n' {
+			if b.Len() == 0 && len(msgs) > 0 {
+				// the line feed right after the split is the messages boundary
+				continue
+			}
+			lastLF = b.Len()
+		}
+		b.WriteString(unit)
+		symbols += n
+	}
+	if msg := strings.TrimSuffix(b.String(), "\n"); msg != "" && (maxMessages <= 0 || len(msgs) < maxMessages) {
+		msgs = append(msgs, msg)
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"plain\ttext\n", "plain\ttext\n"},
+		{"\x1b[0;1;32m●\x1b[0m nginx.service - A high performance web server\n", "● nginx.service - A high performance web server\n"},
+		{"\x1b[01;34mbin\x1b[0m  \x1b[01;36mlib\x1b[0m\n", "bin  lib\n"},
+		{"\x1b]0;user@host: ~\x07prompt\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", "promptlink"},
+		{"\x1b[2K\x1b[1Gdone\x1b7\x1b8", "done"},
+		{"\x1b[1mbold\x1b(B\x1b[m", "bold"},
+		{"10%\r50%\r100%\nnext\r\n", "100%\nnext\n"},
+		{"line\r\n", "line\n"},
+		{"N\bNA\bAM\bME\bE", "NAME"},
+		{"bell\x07 nul\x00 del\x7f \xff", "bell nul del "},
+	}
+	for i, test := range tests {
+		if got := sanitizeOutput(test.output); got != test.want {
+			t.Errorf("%d: Got output: %q, want: %q", i, got, test.want)
+		}
+	}
+}
+
+func TestOutputMessages(t *testing.T) {
+	tests := []struct {
+		output      string
+		code        bool
+		maxSymbols  int
+		maxMessages int
+		msgs        []string
+	}{
+		{"a < b && c > d", false, 0, 0, []string{"a &lt; b &amp;&amp; c &gt; d"}},
+		{"<@U123> `x`", false, 0, 0, []string{"&lt;@U123&gt; `x`"}},
+		{"run ```rm```", true, 0, 0, []string{"```run ˋˋˋrmˋˋˋ```"}},
+		{"0123\n4567\n89", true, 11, 0, []string{"```0123```", "```4567```", "```89```"}},
+		{"a&b\nc&d", false, 8, 0, []string{"a&amp;b", "c&amp;d"}},
+		{"a&b", false, 4, 0, []string{"a", "&amp;", "b"}},
+		{"<<<<\n<<", false, 8, 0, []string{"&lt;&lt;", "&lt;&lt;", "&lt;&lt;"}},
+		{"<<<<\n<<", false, 8, 2, []string{"&lt;&lt;", "&lt;&lt;"}},
+		{"a<b\nc", true, 12, 0, []string{"```a&lt;b```", "```c```"}},
+	}
+	for i, test := range tests {
+		msgs := outputMessages(test.output, test.code, test.maxSymbols, test.maxMessages)
+		if !reflect.DeepEqual(msgs, test.msgs) {
+			t.Errorf("%d: Got msgs: %q, want: %q", i, msgs, test.msgs)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/nlopes/slack"
+	"github.com/robfig/cron/v3"
+	"strings"
+	"sync"
+)
+
+// scheduler runs config schedules through the same path as chat actions
+type scheduler struct {
+	bot     *bot
+	cron    *cron.Cron
+	mu      sync.Mutex
+	entries map[string]cron.EntryID
+	paused  map[string]bool
+}
+
+// newScheduler returns the stopped scheduler without schedules
+func newScheduler(b *bot) *scheduler {
+	return &scheduler{
+		bot:     b,
+		cron:    cron.New(),
+		entries: make(map[string]cron.EntryID),
+		paused:  make(map[string]bool),
+	}
+}
+
+// start starts running schedules in the background
+func (s *scheduler) start() {
+	s.cron.Start()
+}
+
+// sync replaces schedules with the config ones, paused schedules stay paused
+func (s *scheduler) sync(conf *config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, entry := range s.entries {
+		s.cron.Remove(entry)
+		delete(s.entries, id)
+	}
+	for _, sch := range conf.Schedules {
+		id := sch.Id
+		entry, err := s.cron.AddFunc(sch.CronSpec(), func() {
+			if s.isPaused(id) {
+				logger.Info("Schedule is paused, skipping", "schedule", id)
+				return
+			}
+			s.run(id)
+		})
+		if err != nil {
+			logger.Error("Error adding schedule", "schedule", id, "err", err)
+			continue
+		}
+		s.entries[id] = entry
+	}
+}
+
+// run executes the schedule action from the current config and posts the output to the schedule channel
+func (s *scheduler) run(id string) {
+	conf := s.bot.store.Load()
+	sch := findSchedule(conf, id)
+	if sch == nil {
+		logger.Warn("Schedule not found", "schedule", id)
+		return
+	}
+	reply := func(msg string, blocks ...slack.Block) {
+		s.bot.post(sch.Channel, msg, blocks...)
+	}
+	text := sch.Action()
+	log := logger.With("request_id", newRequestID(), "schedule", id)
+	log.Info("Run schedule", "action", text)
+	reply(fmt.Sprintf("_Scheduled_ `%s`: `%s`", id, text))
+	a, err := parseAction(text, conf)
+	if err != nil {
+		reply(fmt.Sprintf("%v", err))
+		return
+	}
+	a.log = log
+	runAction(a, s.bot.run, reply)
+}
+
+// isPaused reports whether the schedule was paused from chat
+func (s *scheduler) isPaused(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused[id]
+}
+
+// command handles schedules chat commands: list, pause <id>, resume <id> and run <id>
+func (s *scheduler) command(args []string, isAdmin bool) string {
+	if len(args) == 0 || args[0] == "list" {
+		return s.list()
+	}
+	if len(args) != 2 {
+		return scheduleHelp
+	}
+	id := args[1]
+	if findSchedule(s.bot.store.Load(), id) == nil {
+		return fmt.Sprintf("schedule *%s* not found", mrkdwnEscaper.Replace(id))
+	}
+	// run posts the results to the schedule channel bypassing the channel permissions, so it is for admins too
+	if !isAdmin {
+		permissionDenials.WithLabelValues("chat", "admin").Inc()
+		return "Only admins can pause, resume and run schedules"
+	}
+	switch args[0] {
+	case "pause", "resume":
+		s.mu.Lock()
+		s.paused[id] = args[0] == "pause"
+		s.mu.Unlock()
+		return fmt.Sprintf("Schedule *%s* %sd", id, args[0])
+	case "run":
+		go s.run(id)
+		return fmt.Sprintf("Schedule *%s* triggered", id)
+	}
+	return scheduleHelp
+}
+
+// list returns schedules with their next run times
+func (s *scheduler) list() string {
+	conf := s.bot.store.Load()
+	if len(conf.Schedules) == 0 {
+		return "No schedules"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("_*Schedules:*_")
+	for _, sch := range conf.Schedules {
+		b.WriteString(fmt.Sprintf("\n`%s`   `%s` %s   `%s` to <#%s>", sch.Id, sch.Spec, sch.Location, sch.Action(), sch.Channel))
+		if s.paused[sch.Id] {
+			b.WriteString("   _paused_")
+		} else if entry, exist := s.entries[sch.Id]; exist {
+			b.WriteString(fmt.Sprintf("   _next: %s_", s.cron.Entry(entry).Next.In(sch.Location).Format("2006-01-02 15:04 MST")))
+		}
+	}
+	return b.String()
+}
+
+// findSchedule returns the config schedule by id or nil if it doesn't exist
+func findSchedule(conf *config.Config, id string) *config.Schedule {
+	for _, sch := range conf.Schedules {
+		if sch.Id == id {
+			return sch
+		}
+	}
+	return nil
+}
+
+const scheduleHelp = "_*Format:*_\n```schedules\nschedule pause <id>\nschedule resume <id>\nschedule run <id>```"
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/karlovskiy/bb8bot/config"
+	"github.com/nlopes/slack"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	conf := makeTestConfig()
+	conf.Schedules = []*config.Schedule{{
+		Id:       "args-missing",
+		Spec:     "0 9 * * *",
+		Location: time.UTC,
+		Group:    "group1",
+		Command:  "command2",
+		Channel:  "C1",
+	}}
+	store := &configStore{}
+	store.current.Store(conf)
+
+	posted := make(chan string, 10)
+	b := &bot{
+		store: store,
+		post: func(channel, text string, blocks ...slack.Block) {
+			posted <- channel + ": " + text
+		},
+	}
+	s := newScheduler(b)
+	s.sync(conf)
+
+	if list := s.command(nil, false); !strings.Contains(list, "`args-missing`   `0 9 * * *` UTC   `group1 command2` to <#C1>   _next: ") {
+		t.Errorf("Got list: %q", list)
+	}
+	for _, command := range []string{"pause", "resume", "run"} {
+		if reply := s.command([]string{command, "args-missing"}, false); reply != "Only admins can pause, resume and run schedules" {
+			t.Errorf("Got reply for %s: %q", command, reply)
+		}
+	}
+	if reply := s.command([]string{"pause", "args-missing"}, true); reply != "Schedule *args-missing* paused" {
+		t.Errorf("Got reply: %q", reply)
+	}
+	if list := s.command([]string{"list"}, false); !strings.HasSuffix(list, "_paused_") {
+		t.Errorf("Got list: %q", list)
+	}
+	s.sync(conf)
+	if !s.isPaused("args-missing") {
+		t.Errorf("Schedule was resumed by sync")
+	}
+	if reply := s.command([]string{"resume", "args-missing"}, true); reply != "Schedule *args-missing* resumed" {
+		t.Errorf("Got reply: %q", reply)
+	}
+	if reply := s.command([]string{"run", "none"}, false); reply != "schedule *none* not found" {
+		t.Errorf("Got reply: %q", reply)
+	}
+
+	s.run("args-missing")
+	for _, want := range []string{
+		"C1: _Scheduled_ `args-missing`: `group1 command2`",
+		"C1: *1* argument not found\ncommand2 help",
+	} {
+		if got := <-posted; got != want {
+			t.Errorf("Got posted: %q, want: %q", got, want)
+		}
+	}
+}
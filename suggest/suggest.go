@@ -0,0 +1,144 @@
+// Package suggest finds names by unambiguous prefixes and suggests similar names for typos.
+package suggest
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSuggestions is the maximum number of suggested names
+const maxSuggestions = 3
+
+// Find returns the target of the name or its unambiguous prefix from names mapped to their targets,
+// like ids and aliases mapped to ids. If the name isn't found, the target is empty and suggestions are
+// the names with the prefix or the names similar by the edit distance, the closest first.
+func Find(name string, names map[string]string) (string, []string) {
+	if target, exist := names[name]; exist {
+		return target, nil
+	}
+	if name == "" {
+		return "", nil
+	}
+
+	prefixed := prefixedNames(name, names)
+	targets := make(map[string]struct{})
+	for _, n := range prefixed {
+		targets[names[n]] = struct{}{}
+	}
+	if len(targets) == 1 {
+		return names[prefixed[0]], nil
+	}
+	return "", suggestions(name, names, prefixed)
+}
+
+// Suggest returns suggestions for the name like Find, but doesn't accept prefixes,
+// so the names with the prefix are suggested even if it is unambiguous. It's nil for existing names.
+func Suggest(name string, names map[string]string) []string {
+	if _, exist := names[name]; exist || name == "" {
+		return nil
+	}
+	return suggestions(name, names, prefixedNames(name, names))
+}
+
+// prefixedNames returns the names with the prefix
+func prefixedNames(prefix string, names map[string]string) []string {
+	var prefixed []string
+	for n := range names {
+		if strings.HasPrefix(n, prefix) {
+			prefixed = append(prefixed, n)
+		}
+	}
+	return prefixed
+}
+
+// suggestions returns the prefixed names, the shortest first,
+// or if there are none the names similar to the name by the edit distance, the closest first
+func suggestions(name string, names map[string]string, prefixed []string) []string {
+	if len(prefixed) > 0 {
+		sort.Slice(prefixed, func(i, j int) bool {
+			if len(prefixed[i]) != len(prefixed[j]) {
+				return len(prefixed[i]) < len(prefixed[j])
+			}
+			return prefixed[i] < prefixed[j]
+		})
+		return limit(prefixed)
+	}
+
+	type similar struct {
+		name     string
+		distance int
+	}
+	maxDistance := utf8.RuneCountInString(name)/3 + 1
+	closest := make(map[string]similar)
+	for n, target := range names {
+		d := Distance(strings.ToLower(name), strings.ToLower(n))
+		if d > maxDistance {
+			continue
+		}
+		// one name for the target, so the id and its alias aren't both suggested
+		if c, exist := closest[target]; !exist || d < c.distance || d == c.distance && n < c.name {
+			closest[target] = similar{n, d}
+		}
+	}
+	found := make([]similar, 0, len(closest))
+	for _, s := range closest {
+		found = append(found, s)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance != found[j].distance {
+			return found[i].distance < found[j].distance
+		}
+		return found[i].name < found[j].name
+	})
+	similarNames := make([]string, len(found))
+	for i, s := range found {
+		similarNames[i] = s.name
+	}
+	return limit(similarNames)
+}
+
+// limit returns up to maxSuggestions names, nil if there are no names
+func limit(names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	if len(names) > maxSuggestions {
+		return names[:maxSuggestions]
+	}
+	return names
+}
+
+// Distance returns the Levenshtein distance between strings: the minimum number
+// of single character insertions, deletions and substitutions to change one into the other
+func Distance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(t)]
+}
+
+// min returns the minimum of the values
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
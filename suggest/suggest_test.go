@@ -0,0 +1,94 @@
+package suggest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"unix", "unix", 0},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"unx", "unix", 1},
+		{"uinx", "unix", 2},
+		{"дискк", "диск", 1},
+	}
+	for i, test := range tests {
+		if d := Distance(test.a, test.b); d != test.distance {
+			t.Errorf("%d: Got distance: %d, want: %d", i, d, test.distance)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	names := map[string]string{
+		"memory":  "memory",
+		"mem":     "memory",
+		"disk":    "disk",
+		"lsof":    "lsof",
+		"logs":    "logs",
+		"loadavg": "loadavg",
+	}
+	tests := []struct {
+		name        string
+		target      string
+		suggestions []string
+	}{
+		{"disk", "disk", nil},
+		{"mem", "memory", nil},
+		{"memo", "memory", nil},
+		{"me", "memory", nil},
+		{"di", "disk", nil},
+		{"lo", "", []string{"logs", "loadavg"}},
+		{"l", "", []string{"logs", "lsof", "loadavg"}},
+		{"dsik", "", []string{"disk"}},
+		{"memroy", "", []string{"memory"}},
+		{"MEM", "", []string{"mem"}},
+		{"lsfo", "", []string{"lsof"}},
+		{"lgos", "", []string{"logs", "lsof"}},
+		{"network", "", nil},
+		{"", "", nil},
+	}
+	for i, test := range tests {
+		target, suggestions := Find(test.name, names)
+		if target != test.target {
+			t.Errorf("%d: Got target: %q, want: %q", i, target, test.target)
+		}
+		if !reflect.DeepEqual(suggestions, test.suggestions) {
+			t.Errorf("%d: Got suggestions: %q, want: %q", i, suggestions, test.suggestions)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	names := map[string]string{
+		"memory": "memory",
+		"mem":    "memory",
+		"disk":   "disk",
+		"lsof":   "lsof",
+		"logs":   "logs",
+	}
+	tests := []struct {
+		name        string
+		suggestions []string
+	}{
+		{"disk", nil},
+		{"mem", nil},
+		{"di", []string{"disk"}},
+		{"me", []string{"mem", "memory"}},
+		{"lo", []string{"logs"}},
+		{"dsik", []string{"disk"}},
+		{"network", nil},
+		{"", nil},
+	}
+	for i, test := range tests {
+		if suggestions := Suggest(test.name, names); !reflect.DeepEqual(suggestions, test.suggestions) {
+			t.Errorf("%d: Got suggestions: %q, want: %q", i, suggestions, test.suggestions)
+		}
+	}
+}